@@ -0,0 +1,220 @@
+// Command loyalty-extract extrai uma NFC-e pela URL do QR Code, pela chave de
+// acesso, por uma página de consulta salva ou pelo XML da NF-e, sem banco de
+// dados. Serve para investigar notas que falharam no aplicativo e para
+// incluir páginas novas no corpus de testes.
+//
+//	loyalty-extract -url 'https://...?p=...' -format table
+//	loyalty-extract -key 3523...3454 -save-fixture pix_dinheiro_troco
+//	loyalty-extract -html nota.html -format csv
+//	loyalty-extract -xml nota.xml
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/joaogustavosp/loyalty-api/internal/models"
+	"github.com/joaogustavosp/loyalty-api/internal/nfce"
+	"github.com/joaogustavosp/loyalty-api/internal/services"
+)
+
+type result struct {
+	Invoice  models.Invoice          `json:"invoice"`
+	Products []models.ProductInvoice `json:"products"`
+}
+
+func main() {
+	var (
+		rawURL      = flag.String("url", "", "URL de consulta do QR Code")
+		key         = flag.String("key", "", "chave de acesso de 44 dígitos")
+		htmlFile    = flag.String("html", "", "página de consulta salva")
+		xmlFile     = flag.String("xml", "", "XML da NF-e")
+		host        = flag.String("host", "", "host do portal da página salva, para escolher o parser")
+		format      = flag.String("format", "json", "formato da saída: json, table ou csv")
+		saveFixture = flag.String("save-fixture", "", "salva a página baixada no corpus de testes com este nome")
+		testdata    = flag.String("testdata", filepath.Join("internal", "nfce", "testdata"), "diretório do corpus de testes")
+		timeout     = flag.Duration("timeout", 30*time.Second, "tempo máximo da consulta à SEFAZ")
+	)
+	flag.Parse()
+
+	inputs := 0
+	for _, v := range []string{*rawURL, *key, *htmlFile, *xmlFile} {
+		if v != "" {
+			inputs++
+		}
+	}
+	if inputs != 1 {
+		fmt.Fprintln(os.Stderr, "informe exatamente uma entrada: -url, -key, -html ou -xml")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	allowlist := services.DefaultHostAllowlist()
+	fetcherConfig := services.DefaultFetcherConfig()
+	fetcherConfig.Allowlist = allowlist
+	extractService := services.NewExtractService(services.NewHTTPFetcher(fetcherConfig), allowlist, services.NewLRUCache(100, time.Minute))
+
+	var (
+		res result
+		err error
+	)
+	switch {
+	case *htmlFile != "" || *xmlFile != "":
+		res, err = extractFile(extractService, *htmlFile+*xmlFile, *host)
+	default:
+		target := *rawURL
+		if *key != "" {
+			target, err = queryURL(*key)
+		}
+		if err == nil {
+			res, err = extractURL(ctx, extractService, target, *saveFixture, *testdata)
+		}
+	}
+	if err != nil {
+		extractErr := services.ClassifyError(err)
+		fmt.Fprintf(os.Stderr, "erro [%s]: %v\n", extractErr.Code, extractErr)
+		os.Exit(1)
+	}
+
+	if err := write(os.Stdout, *format, res); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func queryURL(key string) (string, error) {
+	accessKey, err := nfce.ParseAccessKey(key)
+	if err != nil {
+		return "", err
+	}
+	return nfce.QueryURL(accessKey)
+}
+
+func extractFile(extractService *services.ExtractService, path, host string) (result, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return result{}, err
+	}
+	products, invoice, err := extractService.ExtractFromFile(data, host)
+	return result{invoice, products}, err
+}
+
+// extractURL consulta a SEFAZ. Para salvar a página no corpus, ela é baixada
+// e extraída como o teste do corpus faz, sem host nem chave.
+func extractURL(ctx context.Context, extractService *services.ExtractService, rawURL, fixture, testdata string) (result, error) {
+	if fixture == "" {
+		products, invoice, err := extractService.ExtractData(ctx, rawURL)
+		return result{invoice, products}, err
+	}
+
+	page, err := extractService.FetchPage(ctx, rawURL)
+	if err != nil {
+		return result{}, err
+	}
+	products, invoice, err := extractService.ExtractFromFile(page, "")
+	if err != nil {
+		return result{}, err
+	}
+	res := result{invoice, products}
+	if err := saveFixtureFiles(testdata, fixture, page, res); err != nil {
+		return result{}, err
+	}
+	return res, nil
+}
+
+// saveFixtureFiles grava a página em <testdata>/<uf>/<nome>.html, com o CPF
+// do consumidor mascarado, e o .golden.json esperado ao lado.
+func saveFixtureFiles(testdata, name string, page []byte, res result) error {
+	if cpf := res.Invoice.ConsumerCPF; cpf != "" && !nfce.IsMaskedCPF(cpf) {
+		masked := []byte(res.Invoice.ConsumerCPFMasked)
+		formatted := cpf[0:3] + "." + cpf[3:6] + "." + cpf[6:9] + "-" + cpf[9:11]
+		for _, v := range []string{formatted, cpf} {
+			page = []byte(strings.ReplaceAll(string(page), v, string(masked)))
+		}
+	}
+
+	dir := filepath.Join(testdata, strings.ToLower(res.Invoice.UF))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	base := filepath.Join(dir, strings.TrimSuffix(name, ".html"))
+	if err := os.WriteFile(base+".html", page, 0o644); err != nil {
+		return err
+	}
+
+	golden, err := json.MarshalIndent(res, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(base+".golden.json", append(golden, '\n'), 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "página salva em %s.html; revise e anonimize os dados antes do commit\n", base)
+	return nil
+}
+
+func write(w io.Writer, format string, res result) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(res)
+	case "table":
+		return writeTable(w, res)
+	case "csv":
+		return writeCSV(w, res)
+	}
+	return fmt.Errorf("formato desconhecido: %s", format)
+}
+
+func writeTable(w io.Writer, res result) error {
+	inv := res.Invoice
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Chave\t%s\n", inv.AccessKey)
+	fmt.Fprintf(tw, "Emitente\t%s (%s)\n", inv.Merchant.Name, inv.CNPJ)
+	fmt.Fprintf(tw, "Emissão\t%s\n", inv.IssueDate)
+	fmt.Fprintf(tw, "Total\tR$ %s (bruto %s, desconto %s)\n", inv.Totals.Net, inv.Totals.Gross, inv.Totals.Discount)
+	if inv.Contingency {
+		fmt.Fprintln(tw, "Contingência\tsim")
+	}
+	if len(inv.Warnings) > 0 {
+		fmt.Fprintf(tw, "Avisos\t%s\n", strings.Join(inv.Warnings, ", "))
+	}
+	fmt.Fprintln(tw)
+
+	fmt.Fprintln(tw, "CÓDIGO\tGTIN\tDESCRIÇÃO\tQTDE\tUN\tVL. UNIT.\tVL. TOTAL\tDESCONTO\tCATEGORIA")
+	for _, p := range res.Products {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			p.Code, p.GTIN, p.Name, p.Quantity, p.Unit, p.UnitPrice, p.Value, p.Discount, p.Category)
+	}
+	return tw.Flush()
+}
+
+// writeCSV escreve um produto por linha, separado por ";" como o Excel em
+// português espera, já que os valores usam vírgula decimal.
+func writeCSV(w io.Writer, res result) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = ';'
+	cw.Write([]string{"access_key", "cnpj", "issue_date", "code", "gtin", "ncm", "category", "name", "quantity", "unit", "unit_price", "value", "discount"})
+	for _, p := range res.Products {
+		cw.Write([]string{
+			res.Invoice.AccessKey, res.Invoice.CNPJ, res.Invoice.IssueDate,
+			p.Code, p.GTIN, p.NCM, p.Category, p.Name,
+			p.Quantity.String(), p.Unit, p.UnitPrice.String(), p.Value.String(), p.Discount.String(),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
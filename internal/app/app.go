@@ -1,30 +1,128 @@
 package app
 
 import (
+	"context"
+	"expvar"
 	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	v1 "github.com/joaogustavosp/loyalty-api/internal/app/handlers/v1"
 	"github.com/joaogustavosp/loyalty-api/internal/app/middleware"
 	"github.com/joaogustavosp/loyalty-api/internal/db/mongodb"
+	"github.com/joaogustavosp/loyalty-api/internal/email"
 	"github.com/joaogustavosp/loyalty-api/internal/services"
 )
 
+// cacheFailureTTL é por quanto tempo uma falha de extração é reaproveitada
+// antes de a SEFAZ ser consultada de novo
+const cacheFailureTTL = time.Minute
+
 type App struct {
 	Router *gin.Engine
+	// Debug expõe as métricas de extração (nfce_parse_total,
+	// nfce_layout_changed, ...) em /debug/vars, fora do Router público
+	Debug *http.ServeMux
 }
 
 func NewApp() *App {
 	db := mongodb.GetDatabase("loyalty")
 	userCollection := db.Collection("users")
+	invoiceCollection := db.Collection("invoices")
+	jobCollection := db.Collection("extraction_jobs")
+	cacheCollection := db.Collection("extraction_cache")
+	attemptCollection := db.Collection("claim_attempts")
 
 	userService := services.NewUserService(userCollection)
-	extractService := services.NewExtractService()
+
+	// Hosts oficiais de consulta, acrescidos dos configurados no ambiente
+	allowlist := services.DefaultHostAllowlist()
+	if err := allowlist.AddFromString(os.Getenv("SEFAZ_ALLOWED_HOSTS")); err != nil {
+		log.Fatal(err)
+	}
+	fetcherConfig := services.DefaultFetcherConfig()
+	fetcherConfig.Allowlist = allowlist
+
+	// Cache das extrações: Mongo por padrão, compartilhado entre instâncias,
+	// ou em memória com EXTRACT_CACHE=memory
+	var cache services.ExtractionCache
+	if os.Getenv("EXTRACT_CACHE") == "memory" {
+		cache = services.NewLRUCache(10000, cacheFailureTTL)
+	} else {
+		mongoCache := services.NewMongoCache(cacheCollection, cacheFailureTTL)
+		if err := mongoCache.EnsureIndexes(context.Background()); err != nil {
+			log.Fatal(err)
+		}
+		cache = mongoCache
+	}
+	extractService := services.NewExtractService(services.NewHTTPFetcher(fetcherConfig), allowlist, cache)
+	agePolicy := services.DefaultReceiptAgePolicy()
+	if days, err := strconv.Atoi(os.Getenv("RECEIPT_MAX_AGE_DAYS")); err == nil {
+		agePolicy.MaxAge = time.Duration(days) * 24 * time.Hour
+	}
+	if minutes, err := strconv.Atoi(os.Getenv("RECEIPT_MAX_FUTURE_MINUTES")); err == nil {
+		agePolicy.MaxFuture = time.Duration(minutes) * time.Minute
+	}
+	cpfPolicy, err := services.ParseCPFPolicy(os.Getenv("CPF_POLICY"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	cpfVerifier := services.NewCPFVerifier(userService, cpfPolicy)
+
+	// Regras antifraude: notas a partir de FRAUD_REVIEW_SCORE vão para revisão
+	reviewScore, err := strconv.Atoi(os.Getenv("FRAUD_REVIEW_SCORE"))
+	if err != nil {
+		reviewScore = services.DefaultFraudReviewScore
+	}
+	claimAttempts := services.NewClaimAttemptLog(attemptCollection)
+	if err := claimAttempts.EnsureIndexes(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+	fraudEngine := services.NewFraudEngine(userService, claimAttempts, reviewScore, services.DefaultFraudRules(invoiceCollection, claimAttempts)...)
+
+	invoiceService := services.NewInvoiceService(invoiceCollection, userService, agePolicy, cpfVerifier, fraudEngine)
+	if err := invoiceService.EnsureIndexes(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+
+	workers, err := strconv.Atoi(os.Getenv("EXTRACT_WORKERS"))
+	if err != nil {
+		workers = 4 // Número padrão de workers de extração
+	}
+	jobService := services.NewJobService(jobCollection, extractService, workers)
+	if err := jobService.EnsureIndexes(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+	if err := jobService.Start(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+
+	// Notas pendentes são consultadas de novo por até PENDING_MAX_DAYS dias
+	pendingDays, err := strconv.Atoi(os.Getenv("PENDING_MAX_DAYS"))
+	if err != nil {
+		pendingDays = 7
+	}
+	notifier := services.NewEmailNotifier(userService, email.NewEmailSender())
+	verificationService := services.NewVerificationService(invoiceService, extractService, notifier, time.Duration(pendingDays)*24*time.Hour)
+	verificationService.Start(context.Background())
+	reviewService := services.NewReviewService(invoiceService, notifier)
+
+	batchConcurrency, err := strconv.Atoi(os.Getenv("EXTRACT_BATCH_CONCURRENCY"))
+	if err != nil {
+		batchConcurrency = 4 // Consultas simultâneas à SEFAZ por lote
+	}
+	batchService := services.NewBatchService(extractService, batchConcurrency)
 
 	userHandler := v1.NewUserHandler(userService)
 	authHandler := v1.NewAuthHandler(userService)
-	extractHandler := v1.NewExtractHandler(extractService)
+	extractHandler := v1.NewExtractHandler(extractService, batchService)
+	invoiceHandler := v1.NewInvoiceHandler(invoiceService, extractService, verificationService)
+	jobHandler := v1.NewJobHandler(jobService)
+	reviewHandler := v1.NewReviewHandler(reviewService)
 
 	router := gin.Default()
 
@@ -51,14 +149,51 @@ func NewApp() *App {
 			auth.POST("/forgot-password", authHandler.ForgotPassword)
 			auth.GET("/validate-token", authHandler.ValidateToken)
 		}
-		v1Route.GET("/extract", extractHandler.ExtractData)
+		v1Route.GET("/extract", middleware.AuthMiddleware(), extractHandler.ExtractData)
+		v1Route.POST("/extract/upload", middleware.AuthMiddleware(), extractHandler.UploadData)
+		v1Route.POST("/extract/photo", middleware.AuthMiddleware(), extractHandler.PhotoData)
+		v1Route.POST("/extract/batch", middleware.AuthMiddleware(), extractHandler.BatchData)
+		v1Route.POST("/extract/jobs", middleware.AuthMiddleware(), jobHandler.SubmitJob)
+		v1Route.GET("/extract/jobs/:id", middleware.AuthMiddleware(), jobHandler.GetJob)
+
+		invoices := v1Route.Group("/invoices", middleware.AuthMiddleware())
+		{
+			invoices.POST("", invoiceHandler.SubmitInvoice)
+			invoices.GET("", invoiceHandler.GetUserInvoices)
+		}
+
+		// Fila de revisão antifraude, só para administradores
+		reviews := v1Route.Group("/admin/reviews", middleware.AuthMiddleware(), middleware.AdminMiddleware(userService))
+		{
+			reviews.GET("", reviewHandler.Queue)
+			reviews.POST("/:id/approve", reviewHandler.Approve)
+			reviews.POST("/:id/reject", reviewHandler.Reject)
+		}
 	}
 
+	debug := http.NewServeMux()
+	debug.Handle("/debug/vars", expvar.Handler())
+
 	return &App{
 		Router: router,
+		Debug:  debug,
 	}
 }
 
+// Run atende a API em addr e as métricas em DEBUG_ADDR, por padrão só na
+// interface local: o /debug/vars expõe a linha de comando e o uso de memória
+// do processo e não deve ser alcançável pela internet.
 func (a *App) Run(addr string) {
+	debugAddr := os.Getenv("DEBUG_ADDR")
+	if debugAddr == "" {
+		debugAddr = "127.0.0.1:6060"
+	}
+	go func() {
+		log.Printf("métricas em http://%s/debug/vars", debugAddr)
+		if err := http.ListenAndServe(debugAddr, a.Debug); err != nil {
+			log.Printf("servidor de métricas encerrado: %v", err)
+		}
+	}()
+
 	log.Fatal(a.Router.Run(addr))
 }
@@ -0,0 +1,36 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joaogustavosp/loyalty-api/internal/services"
+)
+
+// extractErrorStatus relaciona cada código de falha de extração ao status HTTP.
+var extractErrorStatus = map[services.ErrorCode]int{
+	services.CodeInvalidURL:         http.StatusBadRequest,
+	services.CodeInvalidDocument:    http.StatusBadRequest,
+	services.CodeUnsupportedState:   http.StatusUnprocessableEntity,
+	services.CodeInvoiceNotFound:    http.StatusNotFound,
+	services.CodeContingencyPending: http.StatusNotFound,
+	services.CodeAlreadyClaimed:     http.StatusConflict,
+	services.CodeCPFRequired:        http.StatusUnprocessableEntity,
+	services.CodeCPFMismatch:        http.StatusForbidden,
+	services.CodeInvoiceTooOld:      http.StatusUnprocessableEntity,
+	services.CodeLayoutChanged:      http.StatusBadGateway,
+	services.CodeSefazUnavailable:   http.StatusServiceUnavailable,
+	services.CodeInternal:           http.StatusInternalServerError,
+}
+
+// respondExtractError responde uma falha de extração ou resgate com o status
+// do seu código e o campo "code", que o aplicativo usa para localizar a
+// mensagem.
+func respondExtractError(c *gin.Context, err error) {
+	extractErr := services.ClassifyError(err)
+	status, ok := extractErrorStatus[extractErr.Code]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+	c.JSON(status, gin.H{"success": false, "message": extractErr.Error(), "code": extractErr.Code, "data": nil})
+}
@@ -0,0 +1,102 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joaogustavosp/loyalty-api/internal/nfce"
+	"github.com/joaogustavosp/loyalty-api/internal/services"
+)
+
+// declaredErrorCodes lê de extract_errors.go todas as constantes do tipo
+// ErrorCode, para que um código novo sem status quebre o teste.
+func declaredErrorCodes(t *testing.T) []services.ErrorCode {
+	t.Helper()
+	file, err := parser.ParseFile(token.NewFileSet(), "../../../services/extract_errors.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var codes []services.ErrorCode
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			value := spec.(*ast.ValueSpec)
+			if ident, ok := value.Type.(*ast.Ident); !ok || ident.Name != "ErrorCode" {
+				continue
+			}
+			for _, v := range value.Values {
+				s, err := strconv.Unquote(v.(*ast.BasicLit).Value)
+				if err != nil {
+					t.Fatal(err)
+				}
+				codes = append(codes, services.ErrorCode(s))
+			}
+		}
+	}
+	if len(codes) == 0 {
+		t.Fatal("nenhum ErrorCode declarado em extract_errors.go")
+	}
+	return codes
+}
+
+func TestExtractErrorStatusCoversAllCodes(t *testing.T) {
+	for _, code := range declaredErrorCodes(t) {
+		if _, ok := extractErrorStatus[code]; !ok {
+			t.Errorf("ErrorCode %s sem status HTTP em extractErrorStatus", code)
+		}
+	}
+}
+
+func TestRespondExtractError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		err    error
+		status int
+		code   services.ErrorCode
+	}{
+		{services.ErrInvalidURL, http.StatusBadRequest, services.CodeInvalidURL},
+		{nfce.ErrInvalidXML, http.StatusBadRequest, services.CodeInvalidDocument},
+		{&nfce.UnsupportedStateError{UF: "XX"}, http.StatusUnprocessableEntity, services.CodeUnsupportedState},
+		{nfce.ErrInvoiceNotFound, http.StatusNotFound, services.CodeInvoiceNotFound},
+		{services.ErrContingencyPending, http.StatusNotFound, services.CodeContingencyPending},
+		{services.ErrInvoiceAlreadyClaimed, http.StatusConflict, services.CodeAlreadyClaimed},
+		{services.ErrConsumerCPFRequired, http.StatusUnprocessableEntity, services.CodeCPFRequired},
+		{services.ErrConsumerCPFMismatch, http.StatusForbidden, services.CodeCPFMismatch},
+		{services.ErrInvoiceTooOld, http.StatusUnprocessableEntity, services.CodeInvoiceTooOld},
+		{nfce.ErrLayoutChanged, http.StatusBadGateway, services.CodeLayoutChanged},
+		{&services.HTTPStatusError{StatusCode: http.StatusServiceUnavailable}, http.StatusServiceUnavailable, services.CodeSefazUnavailable},
+		{errors.New("falha qualquer"), http.StatusInternalServerError, services.CodeInternal},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.code), func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			respondExtractError(c, tt.err)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			var body struct {
+				Success bool               `json:"success"`
+				Code    services.ErrorCode `json:"code"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Success || body.Code != tt.code {
+				t.Errorf("corpo = %s, want code %s", w.Body, tt.code)
+			}
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package v1
 
 import (
+	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 
@@ -8,32 +10,136 @@ import (
 	"github.com/joaogustavosp/loyalty-api/internal/services"
 )
 
+const (
+	// maxUploadSize limita o tamanho das páginas e XMLs enviados
+	maxUploadSize = 5 << 20
+	// maxPhotoSize limita o tamanho das fotos de cupons
+	maxPhotoSize = 10 << 20
+)
+
 type ExtractHandler struct {
 	extractService *services.ExtractService
+	batchService   *services.BatchService
 }
 
-func NewExtractHandler(extractService *services.ExtractService) *ExtractHandler {
-	return &ExtractHandler{extractService}
+func NewExtractHandler(extractService *services.ExtractService, batchService *services.BatchService) *ExtractHandler {
+	return &ExtractHandler{extractService, batchService}
 }
 
 func (h *ExtractHandler) ExtractData(c *gin.Context) {
 	rawURL := c.Query("url")
 	if rawURL == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "URL not provided", "data": nil})
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "URL not provided", "code": services.CodeInvalidURL, "data": nil})
 		return
 	}
 
 	parsedURL, err := url.ParseRequestURI(rawURL)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Invalid URL format", "data": nil})
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Invalid URL format", "code": services.CodeInvalidURL, "data": nil})
 		return
 	}
 
-	products, invoice, err := h.extractService.ExtractData(parsedURL.String())
+	products, invoice, err := h.extractService.ExtractData(c.Request.Context(), parsedURL.String())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Error extracting data: " + err.Error(), "data": nil})
+		respondExtractError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Data extracted successfully", "data": gin.H{"invoice": invoice, "products": products}})
 }
+
+// UploadData extrai a nota de uma página de consulta salva ou do XML da NF-e,
+// enviados como multipart (campo "file") ou no corpo da requisição. O
+// resultado é apenas uma prévia: documentos enviados não são resgatados.
+func (h *ExtractHandler) UploadData(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxUploadSize)
+
+	// Só o multipart é lido como formulário: o corpo de outros tipos, inclusive
+	// o application/x-www-form-urlencoded do "curl -d", é o próprio documento.
+	var body io.Reader = c.Request.Body
+	if c.ContentType() == "multipart/form-data" {
+		file, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "File not provided", "data": nil})
+			return
+		}
+		f, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Error reading file: " + err.Error(), "data": nil})
+			return
+		}
+		defer f.Close()
+		body = f
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Error reading file: " + err.Error(), "data": nil})
+		return
+	}
+	if len(data) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "File not provided", "data": nil})
+		return
+	}
+
+	var host string
+	if rawURL := c.Query("url"); rawURL != "" {
+		if parsedURL, err := url.Parse(rawURL); err == nil {
+			host = parsedURL.Hostname()
+		}
+	}
+
+	products, invoice, err := h.extractService.ExtractFromFile(data, host)
+	if err != nil {
+		respondExtractError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Data extracted successfully", "data": gin.H{"invoice": invoice, "products": products}})
+}
+
+// PhotoData extrai a nota a partir da foto do cupom (campo multipart "photo"),
+// decodificando o QR Code no servidor.
+func (h *ExtractHandler) PhotoData(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxPhotoSize)
+
+	file, err := c.FormFile("photo")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Photo not provided", "data": nil})
+		return
+	}
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Error reading photo: " + err.Error(), "data": nil})
+		return
+	}
+	defer f.Close()
+
+	products, invoice, err := h.extractService.ExtractFromImage(c.Request.Context(), f)
+	if err != nil {
+		respondExtractError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Data extracted successfully", "data": gin.H{"invoice": invoice, "products": products}})
+}
+
+// BatchData extrai um lote de notas, informadas por URL de consulta ou chave
+// de acesso. Cada item tem o seu resultado, na ordem do pedido.
+func (h *ExtractHandler) BatchData(c *gin.Context) {
+	var req struct {
+		Items []string `json:"items" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Invalid request: " + err.Error(), "data": nil})
+		return
+	}
+
+	results, err := h.batchService.Extract(c.Request.Context(), req.Items)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": fmt.Sprintf("Batch must have between 1 and %d items", services.MaxBatchSize), "data": nil})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Batch processed", "data": results})
+}
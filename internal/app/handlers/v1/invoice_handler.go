@@ -0,0 +1,85 @@
+package v1
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joaogustavosp/loyalty-api/internal/models"
+	"github.com/joaogustavosp/loyalty-api/internal/services"
+)
+
+type InvoiceHandler struct {
+	invoiceService      *services.InvoiceService
+	extractService      *services.ExtractService
+	verificationService *services.VerificationService
+}
+
+func NewInvoiceHandler(invoiceService *services.InvoiceService, extractService *services.ExtractService, verificationService *services.VerificationService) *InvoiceHandler {
+	return &InvoiceHandler{invoiceService, extractService, verificationService}
+}
+
+func (h *InvoiceHandler) SubmitInvoice(c *gin.Context) {
+	var req struct {
+		URL string `json:"url" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Erro ao processar os dados: " + err.Error(), "data": nil})
+		return
+	}
+
+	parsedURL, err := url.ParseRequestURI(req.URL)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Formato de URL inválido", "code": services.CodeInvalidURL, "data": nil})
+		return
+	}
+
+	userID := c.GetString("userID")
+	products, invoice, err := h.extractService.ExtractData(c.Request.Context(), parsedURL.String())
+	if err != nil {
+		// Com a SEFAZ indisponível a nota fica pendente e é verificada depois
+		if services.ClassifyError(err).Pendable() {
+			h.claimPending(c, userID, parsedURL.String(), err)
+			return
+		}
+		respondExtractError(c, err)
+		return
+	}
+
+	result, err := h.invoiceService.ClaimInvoice(context.Background(), userID, invoice, products)
+	if err != nil {
+		respondExtractError(c, err)
+		return
+	}
+
+	// Notas com risco de fraude aguardam a revisão manual, sem pontos
+	if result.Status == models.InvoiceInReview {
+		c.JSON(http.StatusAccepted, gin.H{"success": true, "message": "Nota fiscal recebida e em análise", "data": result})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"success": true, "message": "Nota fiscal cadastrada com sucesso", "data": result})
+}
+
+func (h *InvoiceHandler) claimPending(c *gin.Context, userID, rawURL string, cause error) {
+	pending, err := h.invoiceService.ClaimPending(c.Request.Context(), userID, rawURL, h.verificationService.MaxPending(), cause)
+	if err != nil {
+		respondExtractError(c, err)
+		return
+	}
+
+	extractErr := services.ClassifyError(cause)
+	c.JSON(http.StatusAccepted, gin.H{"success": true, "message": "Nota fiscal pendente de verificação: " + extractErr.Error(), "code": extractErr.Code, "data": pending})
+}
+
+func (h *InvoiceHandler) GetUserInvoices(c *gin.Context) {
+	userID := c.GetString("userID")
+	invoices, err := h.invoiceService.GetUserInvoices(context.Background(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Erro ao obter notas fiscais: " + err.Error(), "data": nil})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Notas fiscais obtidas com sucesso", "data": invoices})
+}
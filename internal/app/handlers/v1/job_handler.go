@@ -0,0 +1,57 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joaogustavosp/loyalty-api/internal/services"
+)
+
+type JobHandler struct {
+	jobService *services.JobService
+}
+
+func NewJobHandler(jobService *services.JobService) *JobHandler {
+	return &JobHandler{jobService}
+}
+
+func (h *JobHandler) SubmitJob(c *gin.Context) {
+	var req struct {
+		URL string `json:"url" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Error processing request: " + err.Error(), "data": nil})
+		return
+	}
+
+	parsedURL, err := url.ParseRequestURI(req.URL)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Invalid URL format", "code": services.CodeInvalidURL, "data": nil})
+		return
+	}
+
+	job, err := h.jobService.Submit(context.Background(), c.GetString("userID"), parsedURL.String())
+	if err != nil {
+		respondExtractError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"success": true, "message": "Extraction job queued", "data": job})
+}
+
+func (h *JobHandler) GetJob(c *gin.Context) {
+	job, err := h.jobService.GetJob(context.Background(), c.GetString("userID"), c.Param("id"))
+	if errors.Is(err, services.ErrJobNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "Job not found", "data": nil})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Error getting job: " + err.Error(), "data": nil})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Job retrieved successfully", "data": job})
+}
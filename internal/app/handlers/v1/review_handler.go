@@ -0,0 +1,76 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joaogustavosp/loyalty-api/internal/services"
+)
+
+const (
+	defaultReviewQueueLimit = 50
+	maxReviewQueueLimit     = 200
+)
+
+// ReviewHandler expõe a fila de revisão antifraude aos administradores.
+type ReviewHandler struct {
+	reviewService *services.ReviewService
+}
+
+func NewReviewHandler(reviewService *services.ReviewService) *ReviewHandler {
+	return &ReviewHandler{reviewService}
+}
+
+func (h *ReviewHandler) Queue(c *gin.Context) {
+	limit, err := strconv.ParseInt(c.DefaultQuery("limit", strconv.Itoa(defaultReviewQueueLimit)), 10, 64)
+	if err != nil || limit < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Parâmetro limit inválido", "data": nil})
+		return
+	}
+	if limit > maxReviewQueueLimit {
+		limit = maxReviewQueueLimit
+	}
+
+	invoices, err := h.reviewService.Queue(c.Request.Context(), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Erro ao obter a fila de revisão: " + err.Error(), "data": nil})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Fila de revisão obtida com sucesso", "data": invoices})
+}
+
+func (h *ReviewHandler) Approve(c *gin.Context) {
+	invoice, err := h.reviewService.Approve(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondReviewError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Nota fiscal aprovada", "data": invoice})
+}
+
+func (h *ReviewHandler) Reject(c *gin.Context) {
+	var req struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Erro ao processar os dados: " + err.Error(), "data": nil})
+		return
+	}
+
+	invoice, err := h.reviewService.Reject(c.Request.Context(), c.Param("id"), req.Reason)
+	if err != nil {
+		respondReviewError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Nota fiscal recusada", "data": invoice})
+}
+
+func respondReviewError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrReviewNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "Nota fiscal não encontrada na fila de revisão", "data": nil})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Erro ao revisar nota fiscal: " + err.Error(), "data": nil})
+}
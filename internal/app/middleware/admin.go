@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joaogustavosp/loyalty-api/internal/services"
+)
+
+// AdminMiddleware libera a rota apenas para administradores. Deve vir depois
+// de AuthMiddleware, que identifica o usuário; o perfil é lido do banco a cada
+// requisição, para que a revogação valha sem esperar o token expirar.
+func AdminMiddleware(userService *services.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		isAdmin, err := userService.IsAdmin(c.Request.Context(), c.GetString("userID"))
+		if err != nil || !isAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"success": false, "message": "Acesso restrito a administradores", "data": nil})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "QUEUED"
+	JobRunning   JobStatus = "RUNNING"
+	JobSucceeded JobStatus = "SUCCEEDED"
+	JobFailed    JobStatus = "FAILED"
+	JobRetrying  JobStatus = "RETRYING"
+)
+
+// ExtractionJob é uma extração de nota processada em segundo plano.
+type ExtractionJob struct {
+	ID            string           `json:"id" bson:"_id,omitempty"`
+	UserID        string           `json:"user_id" bson:"user_id"`
+	URL           string           `json:"url" bson:"url"`
+	Status        JobStatus        `json:"status" bson:"status"`
+	Attempts      int              `json:"attempts" bson:"attempts"`
+	Error         string           `json:"error,omitempty" bson:"error,omitempty"`
+	ErrorCode     string           `json:"error_code,omitempty" bson:"error_code,omitempty"`
+	Invoice       *Invoice         `json:"invoice,omitempty" bson:"invoice,omitempty"`
+	Products      []ProductInvoice `json:"products,omitempty" bson:"products,omitempty"`
+	NextAttemptAt time.Time        `json:"next_attempt_at" bson:"next_attempt_at"`
+	CreatedAt     time.Time        `json:"created_at" bson:"created_at"`
+	UpdatedAt     time.Time        `json:"updated_at" bson:"updated_at"`
+}
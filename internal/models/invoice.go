@@ -1,7 +1,82 @@
 package models
 
+import "time"
+
+// InvoiceStatus é a situação de uma nota resgatada.
+type InvoiceStatus string
+
+const (
+	// InvoicePending aguarda a consulta à SEFAZ, que estava fora do ar ou
+	// ainda não tinha a nota
+	InvoicePending  InvoiceStatus = "PENDING"
+	InvoiceVerified InvoiceStatus = "VERIFIED"
+	InvoiceRejected InvoiceStatus = "REJECTED"
+	// InvoiceInReview aguarda a revisão manual por risco de fraude; os pontos
+	// só são creditados na aprovação
+	InvoiceInReview InvoiceStatus = "IN_REVIEW"
+)
+
 type Invoice struct {
-	InvoiceNumber string `json:"invoice_number"`
-	IssueDate     string `json:"issue_date"`
-	CNPJ          string `json:"cnpj"`
+	ID            string `json:"id,omitempty" bson:"_id,omitempty"`
+	UserID        string `json:"user_id,omitempty" bson:"user_id,omitempty"`
+	AccessKey     string `json:"access_key" bson:"access_key"`
+	UF            string `json:"uf" bson:"uf"`
+	IssueYear     int    `json:"issue_year" bson:"issue_year"`
+	IssueMonth    int    `json:"issue_month" bson:"issue_month"`
+	Model         string `json:"model" bson:"model"`
+	Series        string `json:"series" bson:"series"`
+	InvoiceNumber string `json:"invoice_number" bson:"invoice_number"`
+	EmissionType  string `json:"emission_type" bson:"emission_type"`
+	// Contingency indica a emissão em contingência offline (tpEmis 9)
+	Contingency bool   `json:"contingency" bson:"contingency"`
+	NumericCode string `json:"numeric_code" bson:"numeric_code"`
+	// IssueDate é a data de emissão como exibida na nota; IssuedAt é a mesma
+	// data interpretada no horário de Brasília
+	IssueDate string     `json:"issue_date" bson:"issue_date"`
+	IssuedAt  *time.Time `json:"issued_at,omitempty" bson:"issued_at,omitempty"`
+	CNPJ      string     `json:"cnpj" bson:"cnpj"`
+	// ConsumerCPF é o CPF do consumidor como lido da nota, nunca exibido nem
+	// gravado; ConsumerCPFMasked é a versão mascarada
+	ConsumerCPF       string           `json:"-" bson:"-"`
+	ConsumerCPFMasked string           `json:"consumer_cpf,omitempty" bson:"consumer_cpf,omitempty"`
+	Merchant          Merchant         `json:"merchant" bson:"merchant"`
+	Totals            InvoiceTotals    `json:"totals" bson:"totals"`
+	Payments          []Payment        `json:"payments" bson:"payments"`
+	Change            Money            `json:"change" bson:"change"`
+	Products          []ProductInvoice `json:"products,omitempty" bson:"products,omitempty"`
+	// Warnings lista os campos que o portal não exibiu ou o parser não achou
+	Warnings  []string   `json:"warnings,omitempty" bson:"warnings,omitempty"`
+	ClaimedAt *time.Time `json:"claimed_at,omitempty" bson:"claimed_at,omitempty"`
+
+	// Missing lista os campos obrigatórios que o parser procurou na página e
+	// não achou, conferidos por nfce.CheckCompleteness
+	Missing []string `json:"-" bson:"-"`
+
+	// Situação do resgate e pontos concedidos quando a nota é verificada
+	Status     InvoiceStatus `json:"status,omitempty" bson:"status,omitempty"`
+	Points     int64         `json:"points,omitempty" bson:"points,omitempty"`
+	VerifiedAt *time.Time    `json:"verified_at,omitempty" bson:"verified_at,omitempty"`
+
+	// Avaliação antifraude, não exibida ao usuário
+	FraudScore   int      `json:"-" bson:"fraud_score,omitempty"`
+	FraudReasons []string `json:"-" bson:"fraud_reasons,omitempty"`
+
+	// Controle da verificação das notas pendentes
+	SourceURL       string     `json:"-" bson:"source_url,omitempty"`
+	Attempts        int        `json:"attempts,omitempty" bson:"attempts,omitempty"`
+	NextAttemptAt   *time.Time `json:"next_attempt_at,omitempty" bson:"next_attempt_at,omitempty"`
+	PendingUntil    *time.Time `json:"pending_until,omitempty" bson:"pending_until,omitempty"`
+	RejectionCode   string     `json:"rejection_code,omitempty" bson:"rejection_code,omitempty"`
+	RejectionReason string     `json:"rejection_reason,omitempty" bson:"rejection_reason,omitempty"`
+}
+
+// InvoiceTotals são os totais da nota: valor bruto dos produtos, descontos,
+// acréscimos (frete, seguro e outras despesas, só informados no XML), valor
+// líquido pago e o valor aproximado dos tributos (Lei 12.741/2012).
+type InvoiceTotals struct {
+	Gross            Money `json:"gross" bson:"gross"`
+	Discount         Money `json:"discount" bson:"discount"`
+	Surcharges       Money `json:"surcharges,omitempty" bson:"surcharges,omitempty"`
+	Net              Money `json:"net" bson:"net"`
+	ApproximateTaxes Money `json:"approximate_taxes" bson:"approximate_taxes"`
 }
@@ -0,0 +1,10 @@
+package models
+
+// Merchant é o emitente da nota, como impresso no cabeçalho do cupom.
+type Merchant struct {
+	CNPJ              string  `json:"cnpj" bson:"cnpj"`
+	Name              string  `json:"name" bson:"name"`
+	TradeName         string  `json:"trade_name" bson:"trade_name"`
+	StateRegistration string  `json:"state_registration" bson:"state_registration"`
+	Address           Address `json:"address" bson:"address"`
+}
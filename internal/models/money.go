@@ -0,0 +1,253 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money é um valor monetário em centavos de real.
+type Money int64
+
+// Quantity é uma quantidade com quatro casas decimais, a mesma precisão do
+// campo qCom da NF-e.
+type Quantity int64
+
+const (
+	moneyScale    = 2
+	quantityScale = 4
+	// QuantityUnit é a representação de uma unidade inteira em Quantity.
+	QuantityUnit Quantity = 10000
+)
+
+// ParseMoney converte valores no formato brasileiro ("R$ 1.234,56", "12,5").
+// Sem vírgula, um único ponto seguido de uma quantidade de casas diferente de
+// três é tratado como separador decimal ("12.50").
+func ParseMoney(s string) (Money, error) {
+	v, err := parseDecimal(s, moneyScale, detectDecimalSep(s))
+	return Money(v), err
+}
+
+// ParseMoneyDecimal converte valores com ponto decimal, como os do XML da NF-e.
+func ParseMoneyDecimal(s string) (Money, error) {
+	v, err := parseDecimal(s, moneyScale, '.')
+	return Money(v), err
+}
+
+// ParseQuantity converte quantidades no formato brasileiro ("1,500", "2.0000").
+// As quantidades não têm separador de milhar, então sem vírgula o ponto é
+// sempre decimal: "0.512" é o peso de uma mercadoria pesável, não 512
+// unidades.
+func ParseQuantity(s string) (Quantity, error) {
+	v, err := parseDecimal(s, quantityScale, quantityDecimalSep(s))
+	return Quantity(v), err
+}
+
+// ParseQuantityDecimal converte quantidades com ponto decimal, como as do XML.
+func ParseQuantityDecimal(s string) (Quantity, error) {
+	v, err := parseDecimal(s, quantityScale, '.')
+	return Quantity(v), err
+}
+
+// String formata o valor no padrão brasileiro, por exemplo "1.234,56".
+func (m Money) String() string {
+	return formatDecimal(int64(m), moneyScale, moneyScale)
+}
+
+// Reais retorna o valor em reais, para exibição e cálculos aproximados.
+func (m Money) Reais() float64 {
+	return float64(m) / 100
+}
+
+// DivQuantity divide um valor por uma quantidade, como ao obter o preço
+// unitário a partir do total da linha. Retorna zero para quantidade zero.
+func (m Money) DivQuantity(q Quantity) Money {
+	if q == 0 {
+		return 0
+	}
+	return Money(roundDiv(int64(m)*int64(QuantityUnit), int64(q)))
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	v, err := unmarshalDecimal(data, moneyScale, detectDecimalSep)
+	*m = Money(v)
+	return err
+}
+
+// Times multiplica a quantidade por um preço unitário, arredondando para o
+// centavo mais próximo.
+func (q Quantity) Times(price Money) Money {
+	return Money(roundDiv(int64(q)*int64(price), int64(QuantityUnit)))
+}
+
+// String formata a quantidade no padrão brasileiro sem zeros à direita, por
+// exemplo "1" ou "0,356".
+func (q Quantity) String() string {
+	return formatDecimal(int64(q), quantityScale, 0)
+}
+
+func (q Quantity) MarshalJSON() ([]byte, error) {
+	return json.Marshal(q.String())
+}
+
+func (q *Quantity) UnmarshalJSON(data []byte) error {
+	v, err := unmarshalDecimal(data, quantityScale, quantityDecimalSep)
+	*q = Quantity(v)
+	return err
+}
+
+func detectDecimalSep(s string) byte {
+	if strings.Contains(s, ",") {
+		return ','
+	}
+	if strings.Count(s, ".") == 1 {
+		if i := strings.LastIndex(s, "."); len(strings.TrimSpace(s[i+1:])) != 3 {
+			return '.'
+		}
+	}
+	return ','
+}
+
+// quantityDecimalSep escolhe o separador decimal de uma quantidade: a vírgula,
+// se houver, ou o ponto.
+func quantityDecimalSep(s string) byte {
+	if strings.Contains(s, ",") {
+		return ','
+	}
+	return '.'
+}
+
+func parseDecimal(s string, scale int, decimalSep byte) (int64, error) {
+	clean := strings.NewReplacer("R$", "", " ", "", "\u00a0", "").Replace(strings.TrimSpace(s))
+	if clean == "" {
+		return 0, fmt.Errorf("valor vazio")
+	}
+
+	negative := strings.HasPrefix(clean, "-")
+	clean = strings.TrimPrefix(clean, "-")
+
+	thousandsSep := "."
+	if decimalSep == '.' {
+		thousandsSep = ","
+	}
+	intPart, fracPart, hasFrac := strings.Cut(clean, string(decimalSep))
+	// O separador decimal aparece uma vez e é seguido das casas decimais
+	if hasFrac && fracPart == "" {
+		return 0, fmt.Errorf("valor inválido: %q", s)
+	}
+	intPart, ok := ungroup(intPart, thousandsSep)
+	if !ok || !isDigits(fracPart) || intPart == "" && fracPart == "" {
+		return 0, fmt.Errorf("valor inválido: %q", s)
+	}
+	if intPart == "" {
+		intPart = "0"
+	}
+
+	// Arredondar as casas além da escala (meio para cima)
+	roundUp := false
+	if len(fracPart) > scale {
+		roundUp = fracPart[scale] >= '5'
+		fracPart = fracPart[:scale]
+	}
+	fracPart += strings.Repeat("0", scale-len(fracPart))
+
+	v, err := strconv.ParseInt(intPart+fracPart, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("valor inválido: %q", s)
+	}
+	if roundUp {
+		v++
+	}
+	if negative {
+		v = -v
+	}
+	return v, nil
+}
+
+// ungroup remove os separadores de milhar da parte inteira, exigindo grupos de
+// três dígitos depois do primeiro, como em "1.234.567".
+func ungroup(intPart, sep string) (string, bool) {
+	groups := strings.Split(intPart, sep)
+	if len(groups) == 1 {
+		return intPart, isDigits(intPart)
+	}
+	if n := len(groups[0]); n == 0 || n > 3 || !isDigits(groups[0]) {
+		return "", false
+	}
+	for _, g := range groups[1:] {
+		if len(g) != 3 || !isDigits(g) {
+			return "", false
+		}
+	}
+	return strings.Join(groups, ""), true
+}
+
+// formatDecimal formata v (com scale casas implícitas) usando vírgula decimal e
+// ponto de milhar, mantendo pelo menos minFrac casas decimais.
+func formatDecimal(v int64, scale, minFrac int) string {
+	sign := ""
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	digits := fmt.Sprintf("%0*d", scale+1, v)
+	intPart, fracPart := digits[:len(digits)-scale], digits[len(digits)-scale:]
+	for len(fracPart) > minFrac && strings.HasSuffix(fracPart, "0") {
+		fracPart = fracPart[:len(fracPart)-1]
+	}
+
+	var b strings.Builder
+	for i, r := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteByte('.')
+		}
+		b.WriteRune(r)
+	}
+	if fracPart != "" {
+		b.WriteByte(',')
+		b.WriteString(fracPart)
+	}
+	return sign + b.String()
+}
+
+// unmarshalDecimal aceita tanto a forma textual gerada pelo MarshalJSON quanto
+// números JSON.
+func unmarshalDecimal(data []byte, scale int, decimalSep func(string) byte) (int64, error) {
+	if string(data) == "null" {
+		return 0, nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		if s == "" {
+			return 0, nil
+		}
+		return parseDecimal(s, scale, decimalSep(s))
+	}
+	var f float64
+	if err := json.Unmarshal(data, &f); err != nil {
+		return 0, err
+	}
+	return int64(math.Round(f * math.Pow10(scale))), nil
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func roundDiv(a, b int64) int64 {
+	if a < 0 {
+		return -((-a + b/2) / b)
+	}
+	return (a + b/2) / b
+}
@@ -0,0 +1,153 @@
+package models
+
+import "testing"
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Money
+		wantErr bool
+	}{
+		{in: "R$ 1.234,56", want: 123456},
+		{in: "12,5", want: 1250},
+		{in: "12.50", want: 1250},
+		{in: "1.234", want: 123400},
+		{in: "1.234.567", want: 123456700},
+		{in: "0,99", want: 99},
+		{in: ",99", want: 99},
+		{in: "-3,10", want: -310},
+		{in: "R$ 10,00", want: 1000},
+		{in: "5,899", want: 590},
+		{in: "5,894", want: 589},
+		{in: "", wantErr: true},
+		{in: "R$", wantErr: true},
+		{in: "abc", wantErr: true},
+		{in: "1,23x", wantErr: true},
+		{in: "1,2x", wantErr: true},
+		{in: "1,2,3", wantErr: true},
+		{in: "+1,00", wantErr: true},
+		{in: "-", wantErr: true},
+		{in: "1.2.3,4", wantErr: true},
+		{in: "12.", wantErr: true},
+		{in: "12,", wantErr: true},
+		{in: ",5.", wantErr: true},
+		{in: "1..234,00", wantErr: true},
+		{in: "1.23,00", wantErr: true},
+		{in: "1234.567,00", wantErr: true},
+		{in: ".234,00", wantErr: true},
+		{in: "1,234.56", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseMoney(%q) = %d, want erro", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseMoney(%q) = %d, %v, want %d", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		in      string
+		scale   int
+		sep     byte
+		want    int64
+		wantErr bool
+	}{
+		{in: "1,5", scale: 4, sep: ',', want: 15000},
+		{in: "0,3565", scale: 4, sep: ',', want: 3565},
+		{in: "0,35655", scale: 4, sep: ',', want: 3566},
+		{in: "2.0000", scale: 4, sep: '.', want: 20000},
+		{in: "1,234.56", scale: 2, sep: '.', want: 123456},
+		{in: "10.995", scale: 2, sep: '.', want: 1100},
+		{in: "10.994", scale: 2, sep: '.', want: 1099},
+		{in: "1,23x", scale: 2, sep: ',', wantErr: true},
+		{in: "1,239x", scale: 2, sep: ',', wantErr: true},
+		{in: "1.23.4", scale: 2, sep: '.', wantErr: true},
+		{in: "1e3", scale: 2, sep: '.', wantErr: true},
+		{in: "1,2,345.00", scale: 2, sep: '.', wantErr: true},
+		{in: "12.", scale: 2, sep: '.', wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseDecimal(tt.in, tt.scale, tt.sep)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseDecimal(%q) = %d, want erro", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseDecimal(%q, %d) = %d, %v, want %d", tt.in, tt.scale, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseQuantity(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Quantity
+		wantErr bool
+	}{
+		{in: "1", want: 10000},
+		{in: "1,500", want: 15000},
+		{in: "0,356", want: 3560},
+		{in: "2.0000", want: 20000},
+		{in: "0.512", want: 5120},
+		{in: "1.000", want: 10000},
+		{in: "2.500", want: 25000},
+		{in: "1.5", want: 15000},
+		{in: "1.000.000", wantErr: true},
+		{in: "1.", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseQuantity(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseQuantity(%q) = %d, want erro", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseQuantity(%q) = %d, %v, want %d", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		m    Money
+		want string
+	}{
+		{0, "0,00"},
+		{5, "0,05"},
+		{123456, "1.234,56"},
+		{-310, "-3,10"},
+		{100000000, "1.000.000,00"},
+	}
+	for _, tt := range tests {
+		if got := tt.m.String(); got != tt.want {
+			t.Errorf("Money(%d).String() = %q, want %q", tt.m, got, tt.want)
+		}
+	}
+}
+
+func TestQuantityTimesAndDiv(t *testing.T) {
+	if got := (3 * QuantityUnit).Times(333); got != 999 {
+		t.Errorf("3 x 3,33 = %s, want 9,99", got)
+	}
+	if got := Quantity(3565).Times(2999); got != 1069 {
+		t.Errorf("0,3565 x 29,99 = %s, want 10,69", got)
+	}
+	if got := Money(1000).DivQuantity(30 * QuantityUnit); got != 33 {
+		t.Errorf("10,00 / 30 = %s, want 0,33", got)
+	}
+	if got := Money(1000).DivQuantity(0); got != 0 {
+		t.Errorf("10,00 / 0 = %s, want 0", got)
+	}
+}
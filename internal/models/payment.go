@@ -0,0 +1,18 @@
+package models
+
+type PaymentMethod string
+
+const (
+	PaymentCash        PaymentMethod = "CASH"
+	PaymentCreditCard  PaymentMethod = "CREDIT_CARD"
+	PaymentDebitCard   PaymentMethod = "DEBIT_CARD"
+	PaymentPix         PaymentMethod = "PIX"
+	PaymentMealVoucher PaymentMethod = "MEAL_VOUCHER"
+	PaymentOther       PaymentMethod = "OTHER"
+)
+
+type Payment struct {
+	Method      PaymentMethod `json:"method" bson:"method"`
+	Description string        `json:"description" bson:"description"`
+	Amount      Money         `json:"amount" bson:"amount"`
+}
@@ -1,9 +1,32 @@
 package models
 
 type ProductInvoice struct {
-	Name     string `json:"name"`
-	Code     string `json:"code"`
-	Quantity string `json:"quantity"`
-	Unit     string `json:"unit"`
-	Value    string `json:"value"`
+	Name string `json:"name" bson:"name"`
+	Code string `json:"code" bson:"code"`
+	// GTIN é o código de barras (EAN) do produto, vazio quando a nota não traz
+	// um código válido
+	GTIN string `json:"gtin,omitempty" bson:"gtin,omitempty"`
+	// NCM é a classificação fiscal do produto, base da Category
+	NCM       string   `json:"ncm,omitempty" bson:"ncm,omitempty"`
+	Category  string   `json:"category,omitempty" bson:"category,omitempty"`
+	Quantity  Quantity `json:"quantity" bson:"quantity"`
+	Unit      string   `json:"unit" bson:"unit"`
+	UnitPrice Money    `json:"unit_price" bson:"unit_price"`
+	// Value é o valor total da linha antes do desconto
+	Value    Money `json:"value" bson:"value"`
+	Discount Money `json:"discount" bson:"discount"`
+}
+
+// NetValue retorna o valor da linha já descontado.
+func (p ProductInvoice) NetValue() Money {
+	return p.Value - p.Discount
+}
+
+// Identifier identifica o produto: o GTIN, igual em qualquer loja, ou o
+// código interno do estabelecimento quando não há GTIN.
+func (p ProductInvoice) Identifier() string {
+	if p.GTIN != "" {
+		return p.GTIN
+	}
+	return p.Code
 }
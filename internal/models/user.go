@@ -7,6 +7,12 @@ const (
 	Inactive UserStatus = "INACTIVE"
 )
 
+type UserRole string
+
+// RoleAdmin opera a fila de revisão antifraude. O perfil é concedido direto no
+// banco; a API não permite alterá-lo.
+const RoleAdmin UserRole = "ADMIN"
+
 type Address struct {
 	CEP          string `json:"cep"`
 	Address      string `json:"address"`
@@ -26,4 +32,8 @@ type User struct {
 	Address   Address    `json:"address"`
 	Password  string     `json:"password,omitempty"`
 	Status    UserStatus `json:"status"`
+	// Points é o saldo de pontos, alterado apenas por UserService.AddPoints
+	Points int64 `json:"points" bson:"points,omitempty"`
+	// Role é vazio para os usuários comuns
+	Role UserRole `json:"role,omitempty" bson:"role,omitempty"`
 }
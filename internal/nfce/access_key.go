@@ -0,0 +1,155 @@
+package nfce
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/joaogustavosp/loyalty-api/internal/models"
+	"github.com/joaogustavosp/loyalty-api/pkg/utils"
+)
+
+var ErrInvalidAccessKey = errors.New("chave de acesso inválida")
+
+// ufCodes mapeia o código IBGE da UF, usado nos dois primeiros dígitos da
+// chave de acesso, para a sigla do estado.
+var ufCodes = map[string]string{
+	"11": "RO", "12": "AC", "13": "AM", "14": "RR", "15": "PA", "16": "AP", "17": "TO",
+	"21": "MA", "22": "PI", "23": "CE", "24": "RN", "25": "PB", "26": "PE", "27": "AL", "28": "SE", "29": "BA",
+	"31": "MG", "32": "ES", "33": "RJ", "35": "SP",
+	"41": "PR", "42": "SC", "43": "RS",
+	"50": "MS", "51": "MT", "52": "GO", "53": "DF",
+}
+
+// AccessKey é a chave de acesso de 44 dígitos de uma NF-e/NFC-e decomposta
+// nos seus campos.
+type AccessKey struct {
+	Key          string
+	UFCode       string
+	UF           string
+	Year         int
+	Month        int
+	CNPJ         string
+	Model        string
+	Series       string
+	Number       string
+	EmissionType string
+	NumericCode  string
+	CheckDigit   string
+}
+
+// ParseAccessKey valida e decompõe uma chave de acesso. Espaços e pontos usados
+// na formatação impressa da chave são ignorados. As posições do CNPJ aceitam
+// letras, para o CNPJ alfanumérico.
+func ParseAccessKey(s string) (AccessKey, error) {
+	key := strings.NewReplacer(" ", "", ".", "", "-", "").Replace(strings.ToUpper(strings.TrimSpace(s)))
+	if len(key) != 44 {
+		return AccessKey{}, fmt.Errorf("%w: deve ter 44 dígitos", ErrInvalidAccessKey)
+	}
+	for i, r := range key {
+		if r >= '0' && r <= '9' || i >= 6 && i < 18 && r >= 'A' && r <= 'Z' {
+			continue
+		}
+		return AccessKey{}, fmt.Errorf("%w: caractere %q inválido na posição %d", ErrInvalidAccessKey, r, i+1)
+	}
+
+	k := AccessKey{
+		Key:          key,
+		UFCode:       key[0:2],
+		CNPJ:         key[6:20],
+		Model:        key[20:22],
+		Series:       trimZeros(key[22:25]),
+		Number:       trimZeros(key[25:34]),
+		EmissionType: key[34:35],
+		NumericCode:  key[35:43],
+		CheckDigit:   key[43:44],
+	}
+
+	uf, ok := ufCodes[k.UFCode]
+	if !ok {
+		return AccessKey{}, fmt.Errorf("%w: código de UF %s desconhecido", ErrInvalidAccessKey, k.UFCode)
+	}
+	k.UF = uf
+
+	yy, _ := strconv.Atoi(key[2:4])
+	mm, _ := strconv.Atoi(key[4:6])
+	if mm < 1 || mm > 12 {
+		return AccessKey{}, fmt.Errorf("%w: mês de emissão %02d inválido", ErrInvalidAccessKey, mm)
+	}
+	k.Year = 2000 + yy
+	k.Month = mm
+
+	if k.Model != "55" && k.Model != "65" {
+		return AccessKey{}, fmt.Errorf("%w: modelo %s não suportado", ErrInvalidAccessKey, k.Model)
+	}
+
+	if dv := checkDigit(key[:43]); strconv.Itoa(dv) != k.CheckDigit {
+		return AccessKey{}, fmt.Errorf("%w: dígito verificador não confere", ErrInvalidAccessKey)
+	}
+
+	return k, nil
+}
+
+// AccessKeyFromURL extrai a chave de acesso de uma URL de consulta do QR Code,
+// em qualquer das versões lidas por ParseQRPayload.
+func AccessKeyFromURL(rawURL string) (AccessKey, error) {
+	payload, err := ParseQRPayload(rawURL)
+	if err != nil {
+		return AccessKey{}, err
+	}
+	return payload.AccessKey, nil
+}
+
+// FormattedCNPJ retorna o CNPJ do emitente no formato 00.000.000/0000-00.
+func (k AccessKey) FormattedCNPJ() string {
+	return utils.FormatCNPJ(k.CNPJ)
+}
+
+// Apply preenche na nota os campos que podem ser obtidos a partir da chave.
+func (k AccessKey) Apply(invoice *models.Invoice) {
+	invoice.AccessKey = k.Key
+	invoice.UF = k.UF
+	invoice.IssueYear = k.Year
+	invoice.IssueMonth = k.Month
+	invoice.Model = k.Model
+	invoice.Series = k.Series
+	invoice.EmissionType = k.EmissionType
+	invoice.Contingency = k.EmissionType == EmissionTypeOffline
+	invoice.NumericCode = k.NumericCode
+	if invoice.InvoiceNumber == "" {
+		invoice.InvoiceNumber = k.Number
+	}
+	if invoice.CNPJ == "" {
+		invoice.CNPJ = k.FormattedCNPJ()
+	}
+	if invoice.Merchant.CNPJ == "" {
+		invoice.Merchant.CNPJ = invoice.CNPJ
+	}
+}
+
+// checkDigit calcula o dígito verificador módulo 11 da chave, com pesos de 2 a
+// 9 aplicados da direita para a esquerda.
+func checkDigit(digits string) int {
+	sum, weight := 0, 2
+	for i := len(digits) - 1; i >= 0; i-- {
+		sum += int(digits[i]-'0') * weight
+		weight++
+		if weight > 9 {
+			weight = 2
+		}
+	}
+	dv := 11 - sum%11
+	if dv >= 10 {
+		dv = 0
+	}
+	return dv
+}
+
+func trimZeros(s string) string {
+	s = strings.TrimLeft(s, "0")
+	if s == "" {
+		return "0"
+	}
+	return s
+}
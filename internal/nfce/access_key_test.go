@@ -0,0 +1,97 @@
+package nfce
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseAccessKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		want    AccessKey
+		wantErr bool
+	}{
+		{
+			name: "NFC-e de SP",
+			key:  "35230512345678000195650010000123451000123454",
+			want: AccessKey{
+				Key: "35230512345678000195650010000123451000123454", UFCode: "35", UF: "SP",
+				Year: 2023, Month: 5, CNPJ: "12345678000195", Model: "65", Series: "1",
+				Number: "12345", EmissionType: "1", NumericCode: "00012345", CheckDigit: "4",
+			},
+		},
+		{
+			name: "formatação impressa com espaços",
+			key:  "4324 0311 2223 3300 0181 6500 1000 0045 6711 2345 6787",
+			want: AccessKey{
+				Key: "43240311222333000181650010000045671123456787", UFCode: "43", UF: "RS",
+				Year: 2024, Month: 3, CNPJ: "11222333000181", Model: "65", Series: "1",
+				Number: "4567", EmissionType: "1", NumericCode: "12345678", CheckDigit: "7",
+			},
+		},
+		{
+			name: "CNPJ alfanumérico",
+			key:  "35240512ABC34501DE35650010000123451000123456",
+			want: AccessKey{
+				Key: "35240512ABC34501DE35650010000123451000123456", UFCode: "35", UF: "SP",
+				Year: 2024, Month: 5, CNPJ: "12ABC34501DE35", Model: "65", Series: "1",
+				Number: "12345", EmissionType: "1", NumericCode: "00012345", CheckDigit: "6",
+			},
+		},
+		{
+			name: "CNPJ alfanumérico em minúsculas",
+			key:  "35240512abc34501de35650010000123451000123456",
+			want: AccessKey{
+				Key: "35240512ABC34501DE35650010000123451000123456", UFCode: "35", UF: "SP",
+				Year: 2024, Month: 5, CNPJ: "12ABC34501DE35", Model: "65", Series: "1",
+				Number: "12345", EmissionType: "1", NumericCode: "00012345", CheckDigit: "6",
+			},
+		},
+		{name: "dígito verificador errado", key: "35230512345678000195650010000123451000123455", wantErr: true},
+		{name: "dígito verificador alfanumérico errado", key: "35240512ABC34501DE35650010000123451000123457", wantErr: true},
+		{name: "curta demais", key: "3523051234567800019565001000012345100012345", wantErr: true},
+		{name: "longa demais", key: "352305123456780001956500100001234510001234540", wantErr: true},
+		{name: "UF desconhecida", key: "99230512345678000195650010000123451000123454", wantErr: true},
+		{name: "mês inválido", key: "35231312345678000195650010000123451000123454", wantErr: true},
+		{name: "modelo não suportado", key: "35230512345678000195570010000123451000123454", wantErr: true},
+		{name: "letra fora do CNPJ", key: "3523051234567800019565001000012345100012345A", wantErr: true},
+		{name: "letra na data", key: "35A30512345678000195650010000123451000123454", wantErr: true},
+		{name: "letra no modelo", key: "352405123456780001956A0010000123451000123454", wantErr: true},
+		{name: "vazia", key: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseAccessKey(tt.key)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidAccessKey) {
+					t.Fatalf("ParseAccessKey(%q) err = %v, want ErrInvalidAccessKey", tt.key, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseAccessKey(%q) err = %v", tt.key, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseAccessKey(%q) = %+v, want %+v", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckDigit(t *testing.T) {
+	tests := []struct {
+		digits string
+		want   int
+	}{
+		{"3523051234567800019565001000012345100012345", 4},
+		{"4324031122233300018165001000004567112345678", 7},
+		{"3124029876543200019865002000098765110203040", 1},
+		{"35240512ABC34501DE3565001000012345100012345", 6},
+	}
+	for _, tt := range tests {
+		if got := checkDigit(tt.digits); got != tt.want {
+			t.Errorf("checkDigit(%q) = %d, want %d", tt.digits, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package nfce
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"io"
+	"strings"
+)
+
+// CategoryOther é a categoria dos produtos cujo NCM não consta da tabela.
+const CategoryOther = "other"
+
+//go:embed ncm_categories.csv
+var ncmCategoriesCSV string
+
+// ncmCategories relaciona prefixos de NCM (capítulo, posição ou subposição) a
+// uma categoria da árvore de produtos.
+var ncmCategories = loadNCMCategories(ncmCategoriesCSV)
+
+func loadNCMCategories(data string) map[string]string {
+	r := csv.NewReader(strings.NewReader(data))
+	r.Comment = '#'
+	r.FieldsPerRecord = 2
+
+	categories := map[string]string{}
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			panic("nfce: tabela de categorias inválida: " + err.Error())
+		}
+		categories[strings.TrimSpace(record[0])] = strings.TrimSpace(record[1])
+	}
+	return categories
+}
+
+// CategoryForNCM classifica um produto pelo NCM, usando o prefixo mais longo
+// da tabela. Sem NCM a categoria fica vazia.
+func CategoryForNCM(ncm string) string {
+	ncm = strings.NewReplacer(".", "", " ", "").Replace(ncm)
+	if ncm == "" {
+		return ""
+	}
+	for n := len(ncm); n >= 2; n-- {
+		if category, ok := ncmCategories[ncm[:n]]; ok {
+			return category
+		}
+	}
+	return CategoryOther
+}
+
+// findNCM procura o NCM de um item na página de consulta. Poucos portais o
+// exibem; a fonte garantida é o XML da nota.
+func findNCM(text string) string {
+	m := reNCM.FindStringSubmatch(text)
+	if len(m) < 2 {
+		return ""
+	}
+	return strings.ReplaceAll(m[1], ".", "")
+}
+
+// ParentCategory devolve a categoria acima na árvore, ou vazio para as
+// categorias de primeiro nível.
+func ParentCategory(category string) string {
+	i := strings.LastIndex(category, "/")
+	if i < 0 {
+		return ""
+	}
+	return category[:i]
+}
@@ -0,0 +1,98 @@
+package nfce
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/joaogustavosp/loyalty-api/internal/models"
+)
+
+var ErrLayoutChanged = errors.New("layout da página de consulta mudou")
+
+// Contadores por "UF/parser", publicados em /debug/vars, para perceber uma
+// mudança de layout de um portal antes das reclamações dos usuários.
+var (
+	parseTotal      = expvar.NewMap("nfce_parse_total")
+	parseIncomplete = expvar.NewMap("nfce_parse_incomplete")
+	layoutChanged   = expvar.NewMap("nfce_layout_changed")
+)
+
+// LayoutChangedError indica que o parser não encontrou campos essenciais na
+// página, o que quase sempre significa que o portal mudou o HTML.
+type LayoutChangedError struct {
+	UF      string
+	Parser  string
+	Missing []string
+}
+
+func (e *LayoutChangedError) Error() string {
+	return fmt.Sprintf("%s: parser %s (UF %s) não encontrou %s",
+		ErrLayoutChanged, e.Parser, e.UF, strings.Join(e.Missing, ", "))
+}
+
+func (e *LayoutChangedError) Is(target error) bool {
+	return target == ErrLayoutChanged
+}
+
+// CheckCompleteness confere a saída do parser antes de ela ser completada com
+// os dados da chave de acesso. Sem produtos, ou com produtos sem nome ou
+// valor, a extração é inútil e devolve missing; campos do cabeçalho ausentes
+// viram warnings, e a extração segue como sucesso parcial.
+func CheckCompleteness(invoice models.Invoice, products []models.ProductInvoice) (missing, warnings []string) {
+	if len(products) == 0 {
+		missing = append(missing, "products")
+	}
+	for i, p := range products {
+		if p.Name == "" {
+			missing = append(missing, fmt.Sprintf("products[%d].name", i))
+		}
+		if p.Quantity == 0 {
+			warnings = append(warnings, fmt.Sprintf("products[%d].quantity", i))
+		}
+	}
+	// Valor zero é válido (brindes, itens bonificados); só falta o valor que o
+	// parser não encontrou na página
+	missing = append(missing, invoice.Missing...)
+
+	header := []struct {
+		field string
+		empty bool
+	}{
+		{"invoice_number", invoice.InvoiceNumber == ""},
+		{"issue_date", invoice.IssueDate == ""},
+		{"cnpj", invoice.CNPJ == ""},
+		{"merchant.name", invoice.Merchant.Name == ""},
+		{"totals", invoice.Totals.Gross == 0 && invoice.Totals.Net == 0},
+		{"payments", len(invoice.Payments) == 0},
+	}
+	for _, h := range header {
+		if h.empty {
+			warnings = append(warnings, h.field)
+		}
+	}
+	return missing, warnings
+}
+
+// checkParsed aplica CheckCompleteness à saída de um parser e atualiza os
+// contadores. Os warnings ficam registrados na própria nota.
+func checkParsed(uf, parser string, invoice *models.Invoice, products []models.ProductInvoice) error {
+	label := uf + "/" + parser
+	parseTotal.Add(label, 1)
+
+	missing, warnings := CheckCompleteness(*invoice, products)
+	if len(missing) > 0 {
+		layoutChanged.Add(label, 1)
+		err := &LayoutChangedError{UF: uf, Parser: parser, Missing: missing}
+		log.Print(err)
+		return err
+	}
+	if len(warnings) > 0 {
+		parseIncomplete.Add(label, 1)
+		log.Printf("extração parcial, parser %s (UF %s) não encontrou %s", parser, uf, strings.Join(warnings, ", "))
+		invoice.Warnings = warnings
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package nfce
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/joaogustavosp/loyalty-api/internal/models"
+)
+
+func TestCheckCompleteness(t *testing.T) {
+	header := models.Invoice{
+		InvoiceNumber: "123",
+		IssueDate:     "01/05/2023 10:00:00",
+		CNPJ:          "12.345.678/0001-95",
+		Merchant:      models.Merchant{Name: "MERCADO"},
+		Totals:        models.InvoiceTotals{Gross: 1590, Net: 1590},
+		Payments:      []models.Payment{{Method: models.PaymentPix, Amount: 1590}},
+	}
+	tests := []struct {
+		name         string
+		invoice      func(models.Invoice) models.Invoice
+		products     []models.ProductInvoice
+		wantMissing  []string
+		wantWarnings []string
+	}{
+		{
+			name:     "nota completa",
+			products: []models.ProductInvoice{{Name: "CAFE", Quantity: models.QuantityUnit, Value: 1590}},
+		},
+		{
+			name: "item gratuito não é campo ausente",
+			products: []models.ProductInvoice{
+				{Name: "CAFE", Quantity: models.QuantityUnit, Value: 1590},
+				{Name: "BRINDE", Quantity: models.QuantityUnit, Value: 0},
+			},
+		},
+		{
+			name: "valor não encontrado pelo parser",
+			invoice: func(i models.Invoice) models.Invoice {
+				i.Missing = []string{"products[1].value"}
+				return i
+			},
+			products: []models.ProductInvoice{
+				{Name: "CAFE", Quantity: models.QuantityUnit, Value: 1590},
+				{Name: "LEITE", Quantity: models.QuantityUnit},
+			},
+			wantMissing: []string{"products[1].value"},
+		},
+		{
+			name:        "sem produtos",
+			wantMissing: []string{"products"},
+		},
+		{
+			name:         "produto sem nome e sem quantidade",
+			products:     []models.ProductInvoice{{Value: 1590}},
+			wantMissing:  []string{"products[0].name"},
+			wantWarnings: []string{"products[0].quantity"},
+		},
+		{
+			name: "cabeçalho incompleto",
+			invoice: func(i models.Invoice) models.Invoice {
+				i.CNPJ = ""
+				i.Payments = nil
+				return i
+			},
+			products:     []models.ProductInvoice{{Name: "CAFE", Quantity: models.QuantityUnit, Value: 1590}},
+			wantWarnings: []string{"cnpj", "payments"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invoice := header
+			if tt.invoice != nil {
+				invoice = tt.invoice(invoice)
+			}
+			missing, warnings := CheckCompleteness(invoice, tt.products)
+			if !reflect.DeepEqual(missing, tt.wantMissing) {
+				t.Errorf("missing = %v, want %v", missing, tt.wantMissing)
+			}
+			if !reflect.DeepEqual(warnings, tt.wantWarnings) {
+				t.Errorf("warnings = %v, want %v", warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestParserReportsMissingValue(t *testing.T) {
+	page := `<table id="tabResult">
+<tr><td><span class="txtTit">CAFE</span><span class="Rqtd">Qtde.:1</span></td><td><span class="valor">15,90</span></td></tr>
+<tr><td><span class="txtTit">BRINDE</span><span class="Rqtd">Qtde.:1</span></td><td><span class="valor">0,00</span></td></tr>
+<tr><td><span class="txtTit">LEITE</span><span class="Rqtd">Qtde.:1</span></td><td><span class="valor"></span></td></tr>
+</table>`
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+	products, invoice, err := svrsParser{}.Parse(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(products) != 3 {
+		t.Fatalf("len(products) = %d, want 3", len(products))
+	}
+	if want := []string{"products[2].value"}; !reflect.DeepEqual(invoice.Missing, want) {
+		t.Errorf("Missing = %v, want %v", invoice.Missing, want)
+	}
+}
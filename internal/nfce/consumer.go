@@ -0,0 +1,68 @@
+package nfce
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/joaogustavosp/loyalty-api/internal/models"
+)
+
+// Expressão regular para o CPF do consumidor, completo ou mascarado com "*"
+var reConsumerCPF = regexp.MustCompile(`CPF:?\s*([\d*]{3}\.?[\d*]{3}\.?[\d*]{3}-?[\d*]{2})(?:[^\d*]|$)`)
+
+// findConsumerCPF procura o CPF do consumidor no texto da página. O valor
+// devolvido tem 11 caracteres, dígitos ou "*" onde o portal mascarou.
+func findConsumerCPF(text string) string {
+	m := reConsumerCPF.FindStringSubmatch(text)
+	if len(m) < 2 {
+		return ""
+	}
+	return normalizeCPF(m[1])
+}
+
+func normalizeCPF(s string) string {
+	cpf := strings.NewReplacer(".", "", "-", "", " ", "").Replace(strings.TrimSpace(s))
+	if len(cpf) != 11 || strings.Trim(cpf, "*") == "" {
+		return ""
+	}
+	return cpf
+}
+
+// MaskCPF mascara um CPF exibindo apenas os seis dígitos do meio, como os
+// portais fazem: ***.982.247-**.
+func MaskCPF(cpf string) string {
+	cpf = normalizeCPF(cpf)
+	if cpf == "" {
+		return ""
+	}
+	return "***." + cpf[3:6] + "." + cpf[6:9] + "-**"
+}
+
+// applyConsumerCPF guarda o CPF lido da nota e a sua versão mascarada, a
+// única que é exibida e gravada.
+func applyConsumerCPF(invoice *models.Invoice, cpf string) {
+	invoice.ConsumerCPF = normalizeCPF(cpf)
+	invoice.ConsumerCPFMasked = MaskCPF(invoice.ConsumerCPF)
+}
+
+// ConsumerCPFMatches compara o CPF da nota com o de um usuário. Nos dígitos
+// mascarados pelo portal vale a comparação dos dígitos visíveis.
+func ConsumerCPFMatches(printed, userCPF string) bool {
+	printed = normalizeCPF(printed)
+	userCPF = normalizeCPF(userCPF)
+	if printed == "" || userCPF == "" {
+		return false
+	}
+	for i := range printed {
+		if printed[i] != '*' && printed[i] != userCPF[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// IsMaskedCPF indica se o portal ocultou parte do CPF, o que impede saber a
+// quem ele pertence.
+func IsMaskedCPF(cpf string) bool {
+	return strings.Contains(cpf, "*")
+}
@@ -0,0 +1,79 @@
+package nfce
+
+import "testing"
+
+func TestFindConsumerCPF(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"CPF formatado", "CONSUMIDOR - CPF: 529.982.247-25 - Nome", "52998224725"},
+		{"CPF sem formatação", "CPF 52998224725", "52998224725"},
+		{"CPF mascarado", "Consumidor CPF: ***.982.247-** ", "***982247**"},
+		{"CPF no fim do texto", "CPF: 529.982.247-25", "52998224725"},
+		{"consumidor não identificado", "CONSUMIDOR NÃO IDENTIFICADO", ""},
+		{"consumidor com CNPJ", "CONSUMIDOR - CNPJ: 12.345.678/0001-95", ""},
+		{"CNPJ no campo do CPF", "CPF/CNPJ: 12.345.678/0001-95", ""},
+		{"CNPJ sem formatação no campo do CPF", "CPF: 12345678000195", ""},
+		{"só asteriscos", "CPF: ***.***.***-**", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := findConsumerCPF(tt.text); got != tt.want {
+				t.Errorf("findConsumerCPF(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaskCPF(t *testing.T) {
+	tests := []struct {
+		cpf  string
+		want string
+	}{
+		{"529.982.247-25", "***.982.247-**"},
+		{"52998224725", "***.982.247-**"},
+		{"***982247**", "***.982.247-**"},
+		{"5299822472", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := MaskCPF(tt.cpf); got != tt.want {
+			t.Errorf("MaskCPF(%q) = %q, want %q", tt.cpf, got, tt.want)
+		}
+	}
+}
+
+func TestConsumerCPFMatches(t *testing.T) {
+	tests := []struct {
+		name    string
+		printed string
+		user    string
+		want    bool
+	}{
+		{"CPF completo igual", "52998224725", "529.982.247-25", true},
+		{"CPF completo diferente", "11144477735", "52998224725", false},
+		{"mascarado com os dígitos visíveis iguais", "***.982.247-**", "52998224725", true},
+		{"mascarado com os dígitos visíveis diferentes", "***.444.777-**", "52998224725", false},
+		{"nota sem CPF", "", "52998224725", false},
+		{"usuário sem CPF", "52998224725", "", false},
+		{"CNPJ na nota", "12345678000195", "52998224725", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ConsumerCPFMatches(tt.printed, tt.user); got != tt.want {
+				t.Errorf("ConsumerCPFMatches(%q, %q) = %v, want %v", tt.printed, tt.user, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsMaskedCPF(t *testing.T) {
+	if !IsMaskedCPF("***982247**") {
+		t.Error("IsMaskedCPF(mascarado) = false")
+	}
+	if IsMaskedCPF("52998224725") {
+		t.Error("IsMaskedCPF(completo) = true")
+	}
+}
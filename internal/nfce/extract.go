@@ -0,0 +1,140 @@
+package nfce
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/joaogustavosp/loyalty-api/internal/models"
+	"github.com/joaogustavosp/loyalty-api/pkg/utils"
+)
+
+var (
+	ErrAccessKeyNotFound = errors.New("chave de acesso não encontrada no documento")
+	ErrInvoiceNotFound   = errors.New("nota fiscal não encontrada na SEFAZ")
+)
+
+// notFoundMessages são os avisos que os portais exibem, com status 200, quando
+// a nota consultada não existe ou ainda não foi transmitida.
+var notFoundMessages = []string{
+	"nfc-e não encontrada",
+	"nf-e não encontrada",
+	"nota fiscal não encontrada",
+	"nota fiscal não localizada",
+	"não foi possível localizar a nfc-e",
+	"chave de acesso inexistente",
+}
+
+// Expressão regular para a chave de acesso impressa em grupos de quatro
+// caracteres. Do sétimo ao décimo oitavo ficam as posições do CNPJ, que podem
+// ter letras.
+var rePrintedAccessKey = regexp.MustCompile(`\d{4}\s*\d{2}[0-9A-Z]{2}\s*(?:[0-9A-Z]{4}\s*){2}[0-9A-Z]{2}\d{2}\s*(?:\d{4}\s*){5}\d{4}`)
+
+// ParseHTML lê a página de consulta do QR Code, baixada do portal ou salva
+// pelo usuário. O parser é escolhido pelo host do portal e pela chave de
+// acesso; sem chave, ela é procurada no texto da página.
+func ParseHTML(r io.Reader, host string, key *AccessKey) ([]models.ProductInvoice, models.Invoice, error) {
+	doc, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		return nil, models.Invoice{}, err
+	}
+
+	if isNotFoundPage(doc) {
+		return nil, models.Invoice{}, ErrInvoiceNotFound
+	}
+
+	if key == nil {
+		found, err := findAccessKey(doc)
+		if err != nil {
+			return nil, models.Invoice{}, err
+		}
+		key = &found
+	}
+
+	parser, err := ParserFor(host, *key)
+	if err != nil {
+		return nil, models.Invoice{}, err
+	}
+
+	products, invoice, err := parser.Parse(doc)
+	if err != nil {
+		return nil, models.Invoice{}, err
+	}
+	applyConsumerCPF(&invoice, findConsumerCPF(doc.Text()))
+	if err := checkParsed(key.UF, parser.Name(), &invoice, products); err != nil {
+		return nil, models.Invoice{}, err
+	}
+	return finish(products, invoice, *key)
+}
+
+// IsXML indica se o conteúdo enviado é um XML de NF-e e não uma página HTML.
+func IsXML(data []byte) bool {
+	head := bytes.TrimSpace(data)
+	if len(head) > 512 {
+		head = head[:512]
+	}
+	return bytes.HasPrefix(head, []byte("<?xml")) ||
+		bytes.Contains(head, []byte("<nfeProc")) ||
+		bytes.Contains(head, []byte("<NFe"))
+}
+
+// finish aplica os dados da chave de acesso e confere os totais, passos comuns
+// a todas as origens da nota.
+func finish(products []models.ProductInvoice, invoice models.Invoice, key AccessKey) ([]models.ProductInvoice, models.Invoice, error) {
+	applyCNPJ(&invoice, key)
+	key.Apply(&invoice)
+	if err := applyIssueDate(&invoice, key); err != nil {
+		return nil, models.Invoice{}, err
+	}
+	for i := range products {
+		products[i].Category = CategoryForNCM(products[i].NCM)
+	}
+	if err := ReconcileTotals(&invoice, products); err != nil {
+		return nil, models.Invoice{}, err
+	}
+	return products, invoice, nil
+}
+
+// applyCNPJ confere o CNPJ do emitente lido da nota com o da chave de acesso.
+// Um CNPJ inválido ou diferente do da chave é trocado pelo da chave e vira
+// warning; o CNPJ aceito é gravado sempre no formato 00.000.000/0000-00.
+func applyCNPJ(invoice *models.Invoice, key AccessKey) {
+	if invoice.CNPJ != "" {
+		cnpj := utils.NormalizeCNPJ(invoice.CNPJ)
+		if utils.IsValidCNPJ(cnpj) && cnpj == key.CNPJ {
+			invoice.CNPJ = utils.FormatCNPJ(cnpj)
+		} else {
+			invoice.Warnings = append(invoice.Warnings, "cnpj")
+			invoice.CNPJ = key.FormattedCNPJ()
+		}
+	}
+	if invoice.Merchant.CNPJ != "" {
+		invoice.Merchant.CNPJ = invoice.CNPJ
+	}
+}
+
+// findAccessKey procura no texto da página a primeira sequência de 44 dígitos
+// que seja uma chave de acesso válida.
+func findAccessKey(doc *goquery.Document) (AccessKey, error) {
+	for _, candidate := range rePrintedAccessKey.FindAllString(doc.Text(), -1) {
+		if key, err := ParseAccessKey(candidate); err == nil {
+			return key, nil
+		}
+	}
+	return AccessKey{}, ErrAccessKeyNotFound
+}
+
+// isNotFoundPage reconhece a página de aviso de nota inexistente, que não tem
+// tabela de produtos e, sem esta verificação, pareceria uma mudança de layout.
+func isNotFoundPage(doc *goquery.Document) bool {
+	text := strings.ToLower(strings.Join(strings.Fields(doc.Find("body").Text()), " "))
+	for _, msg := range notFoundMessages {
+		if strings.Contains(text, msg) {
+			return true
+		}
+	}
+	return false
+}
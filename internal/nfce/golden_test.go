@@ -0,0 +1,118 @@
+package nfce
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/joaogustavosp/loyalty-api/internal/models"
+)
+
+// Regenerar os arquivos esperados após uma mudança intencional:
+//
+//	go test ./internal/nfce -run TestGolden -update
+var update = flag.Bool("update", false, "regrava os arquivos .golden.json a partir da saída atual")
+
+type goldenResult struct {
+	Invoice  models.Invoice          `json:"invoice"`
+	Products []models.ProductInvoice `json:"products"`
+}
+
+// TestGolden roda cada página salva em testdata/<uf>/*.html, e cada XML em
+// testdata/xml/*.xml, e compara o resultado com o .golden.json ao lado.
+func TestGolden(t *testing.T) {
+	pages, _ := filepath.Glob(filepath.Join("testdata", "*", "*.html"))
+	xmls, _ := filepath.Glob(filepath.Join("testdata", "xml", "*.xml"))
+	fixtures := append(pages, xmls...)
+	if len(fixtures) == 0 {
+		t.Fatal("nenhuma nota encontrada em testdata")
+	}
+
+	for _, fixture := range fixtures {
+		name := strings.TrimPrefix(filepath.ToSlash(fixture), "testdata/")
+		t.Run(name, func(t *testing.T) {
+			f, err := os.Open(fixture)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			var result goldenResult
+			if strings.HasSuffix(fixture, ".xml") {
+				result.Products, result.Invoice, err = ParseXML(f)
+			} else {
+				result.Products, result.Invoice, err = ParseHTML(f, "", nil)
+			}
+			if err != nil {
+				t.Fatalf("erro ao extrair: %v", err)
+			}
+
+			got, err := json.MarshalIndent(result, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+
+			golden := strings.TrimSuffix(fixture, filepath.Ext(fixture)) + ".golden.json"
+			if *update {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("arquivo esperado ausente, rode com -update: %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("saída diferente de %s\n%s", golden, diffLines(string(want), string(got)))
+			}
+		})
+	}
+}
+
+// TestGoldenCoversEveryParser garante que todo parser registrado tenha ao
+// menos uma página no corpus, para que mudanças de layout não passem sem
+// teste.
+func TestGoldenCoversEveryParser(t *testing.T) {
+	covered := map[reflect.Type]bool{}
+	pages, _ := filepath.Glob(filepath.Join("testdata", "*", "*.html"))
+	for _, page := range pages {
+		uf := strings.ToUpper(filepath.Base(filepath.Dir(page)))
+		if p, ok := portals[uf]; ok {
+			covered[reflect.TypeOf(p.parser)] = true
+		}
+	}
+
+	for uf, p := range portals {
+		if !covered[reflect.TypeOf(p.parser)] {
+			t.Errorf("parser %T (UF %s) sem página em testdata", p.parser, uf)
+		}
+	}
+}
+
+// diffLines mostra as linhas que diferem entre o esperado e o obtido.
+func diffLines(want, got string) string {
+	w, g := strings.Split(want, "\n"), strings.Split(got, "\n")
+	var b strings.Builder
+	for i := 0; i < len(w) || i < len(g); i++ {
+		var wl, gl string
+		if i < len(w) {
+			wl = w[i]
+		}
+		if i < len(g) {
+			gl = g[i]
+		}
+		if wl != gl {
+			fmt.Fprintf(&b, "linha %d:\n  - %s\n  + %s\n", i+1, wl, gl)
+		}
+	}
+	return b.String()
+}
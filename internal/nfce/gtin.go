@@ -0,0 +1,39 @@
+package nfce
+
+import (
+	"strings"
+
+	"github.com/joaogustavosp/loyalty-api/pkg/utils"
+)
+
+// findGTIN procura o GTIN de um item na página de consulta. Quando o portal
+// não exibe o GTIN, o código do item é aproveitado se for um EAN-13 ou GTIN-14
+// válido, já que muitos estabelecimentos usam o código de barras como código
+// interno. Códigos mais curtos ficam de fora para não confundir códigos
+// internos com GTIN-8 por coincidência do dígito verificador.
+func findGTIN(text, code string) string {
+	if m := reGTIN.FindStringSubmatch(text); len(m) > 1 {
+		return validGTIN(m[1])
+	}
+	if len(code) == 13 || len(code) == 14 {
+		return validGTIN(code)
+	}
+	return ""
+}
+
+// xmlGTIN usa o cEAN do produto e, na falta dele, o cEANTrib da unidade
+// tributável. "SEM GTIN" e códigos inválidos resultam em vazio.
+func xmlGTIN(cEAN, cEANTrib string) string {
+	if gtin := validGTIN(cEAN); gtin != "" {
+		return gtin
+	}
+	return validGTIN(cEANTrib)
+}
+
+func validGTIN(s string) string {
+	s = strings.TrimSpace(s)
+	if !utils.IsValidGTIN(s) {
+		return ""
+	}
+	return s
+}
@@ -0,0 +1,77 @@
+package nfce
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	// Base de fusos embutida, para não depender do tzdata da imagem
+	_ "time/tzdata"
+
+	"github.com/joaogustavosp/loyalty-api/internal/models"
+)
+
+var ErrIssueDateMismatch = errors.New("data de emissão não confere com a chave de acesso")
+
+// Location é o fuso em que as datas de emissão exibidas pelos portais são
+// interpretadas e em que IssuedAt é gravado.
+var Location = loadLocation()
+
+func loadLocation() *time.Location {
+	loc, err := time.LoadLocation("America/Sao_Paulo")
+	if err != nil {
+		// Sem horário de verão desde 2019, Brasília é UTC-3 o ano todo
+		return time.FixedZone("BRT", -3*60*60)
+	}
+	return loc
+}
+
+// issueDateLayouts são os formatos de data de emissão vistos nos portais.
+var issueDateLayouts = []string{
+	"02/01/2006 15:04:05",
+	"02/01/2006 15:04",
+	"02/01/2006",
+}
+
+// ParseIssueDate interpreta a data de emissão exibida na página de consulta,
+// que não traz o fuso, no horário de Brasília.
+func ParseIssueDate(s string) (time.Time, error) {
+	s = strings.Join(strings.Fields(s), " ")
+	for _, layout := range issueDateLayouts {
+		if t, err := time.ParseInLocation(layout, s, Location); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("data de emissão %q em formato desconhecido", s)
+}
+
+// applyIssueDate preenche IssuedAt a partir do texto da data de emissão,
+// quando o parser ainda não o fez, e confere o ano e o mês com a chave de
+// acesso. Uma data ilegível vira warning; uma data de outro mês invalida a
+// nota.
+func applyIssueDate(invoice *models.Invoice, key AccessKey) error {
+	if invoice.IssuedAt == nil {
+		t, err := ParseIssueDate(invoice.IssueDate)
+		if err != nil {
+			if invoice.IssueDate != "" {
+				invoice.Warnings = append(invoice.Warnings, "issued_at")
+			}
+			return nil
+		}
+		invoice.IssuedAt = &t
+	}
+
+	// A chave usa o mês no fuso do emitente, que o XML preserva; o horário de
+	// Brasília também é aceito para as datas lidas das páginas
+	emitted := *invoice.IssuedAt
+	local := emitted.In(Location)
+	if !sameMonth(emitted, key) && !sameMonth(local, key) {
+		return fmt.Errorf("%w: emitida em %s, chave de %02d/%d", ErrIssueDateMismatch, emitted.Format("02/01/2006"), key.Month, key.Year)
+	}
+	invoice.IssuedAt = &local
+	return nil
+}
+
+func sameMonth(t time.Time, key AccessKey) bool {
+	return t.Year() == key.Year && int(t.Month()) == key.Month
+}
@@ -0,0 +1,103 @@
+package nfce
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/joaogustavosp/loyalty-api/internal/models"
+)
+
+func TestParseIssueDate(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Time
+		wantErr bool
+	}{
+		{in: "15/05/2023 18:42:10", want: time.Date(2023, 5, 15, 18, 42, 10, 0, Location)},
+		{in: "15/05/2023 18:42", want: time.Date(2023, 5, 15, 18, 42, 0, 0, Location)},
+		{in: "15/05/2023", want: time.Date(2023, 5, 15, 0, 0, 0, 0, Location)},
+		{in: "  15/05/2023\n\t18:42:10 ", want: time.Date(2023, 5, 15, 18, 42, 10, 0, Location)},
+		{in: "2023-05-15T18:42:10-03:00", wantErr: true},
+		{in: "31/02/2023", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseIssueDate(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseIssueDate(%q) = %v, want erro", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("ParseIssueDate(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestApplyIssueDate(t *testing.T) {
+	key := AccessKey{Year: 2024, Month: 5}
+	// Emitida no Amazonas (UTC-4) no último dia do mês, já junho em Brasília
+	amazonas := time.Date(2024, 5, 31, 23, 30, 0, 0, time.FixedZone("AMT", -4*60*60))
+
+	tests := []struct {
+		name        string
+		invoice     models.Invoice
+		wantErr     error
+		wantIssued  time.Time
+		wantWarning bool
+	}{
+		{
+			name:       "data da página no mês da chave",
+			invoice:    models.Invoice{IssueDate: "10/05/2024 09:15:00"},
+			wantIssued: time.Date(2024, 5, 10, 9, 15, 0, 0, Location),
+		},
+		{
+			name:    "data da página em outro mês",
+			invoice: models.Invoice{IssueDate: "10/04/2024 09:15:00"},
+			wantErr: ErrIssueDateMismatch,
+		},
+		{
+			name:    "data da página em outro ano",
+			invoice: models.Invoice{IssueDate: "10/05/2023 09:15:00"},
+			wantErr: ErrIssueDateMismatch,
+		},
+		{
+			name:       "XML com fuso do emitente no limite do mês",
+			invoice:    models.Invoice{IssuedAt: &amazonas},
+			wantIssued: amazonas,
+		},
+		{
+			name:        "data ilegível",
+			invoice:     models.Invoice{IssueDate: "ontem"},
+			wantWarning: true,
+		},
+		{name: "sem data"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invoice := tt.invoice
+			err := applyIssueDate(&invoice, key)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("applyIssueDate err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyIssueDate err = %v", err)
+			}
+			if tt.wantIssued.IsZero() {
+				if invoice.IssuedAt != nil {
+					t.Errorf("IssuedAt = %v, want nil", invoice.IssuedAt)
+				}
+			} else if invoice.IssuedAt == nil || !invoice.IssuedAt.Equal(tt.wantIssued) || invoice.IssuedAt.Location() != Location {
+				t.Errorf("IssuedAt = %v, want %v no horário de Brasília", invoice.IssuedAt, tt.wantIssued)
+			}
+			if got := len(invoice.Warnings) > 0; got != tt.wantWarning {
+				t.Errorf("Warnings = %v", invoice.Warnings)
+			}
+		})
+	}
+}
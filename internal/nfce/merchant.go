@@ -0,0 +1,86 @@
+package nfce
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/joaogustavosp/loyalty-api/internal/models"
+	"golang.org/x/net/html"
+)
+
+// Expressão regular para extrair a inscrição estadual do cabeçalho
+var reIE = regexp.MustCompile(`Inscrição Estadual:\s*([0-9A-Za-z./-]+)`)
+
+// parseAddressLine decompõe o endereço do emitente no formato usado pelos
+// portais: "LOGRADOURO, NÚMERO, COMPLEMENTO, BAIRRO, MUNICÍPIO, UF". Partes
+// vazias, como o complemento, são descartadas no logradouro.
+func parseAddressLine(line string) models.Address {
+	var parts []string
+	for _, p := range strings.Split(line, ",") {
+		parts = append(parts, strings.Join(strings.Fields(p), " "))
+	}
+	if len(parts) < 4 {
+		return models.Address{Address: strings.Join(strings.Fields(line), " ")}
+	}
+
+	n := len(parts)
+	var street []string
+	for _, p := range parts[:n-3] {
+		if p != "" {
+			street = append(street, p)
+		}
+	}
+	return models.Address{
+		Address:      strings.Join(street, ", "),
+		Neighborhood: parts[n-3],
+		City:         parts[n-2],
+		State:        parts[n-1],
+	}
+}
+
+// labeledValue procura um rótulo em <strong> ou <label> e devolve o texto que
+// o segue até o próximo rótulo ou quebra de linha.
+func labeledValue(sel *goquery.Selection, label string) string {
+	var value strings.Builder
+	sel.Find("strong, label").EachWithBreak(func(i int, s *goquery.Selection) bool {
+		if !strings.HasPrefix(strings.TrimSpace(s.Text()), label) {
+			return true
+		}
+		for n := s.Get(0).NextSibling; n != nil; n = n.NextSibling {
+			if n.Type == html.ElementNode && (n.Data == "strong" || n.Data == "label" || n.Data == "br") {
+				break
+			}
+			if n.Type == html.TextNode {
+				value.WriteString(n.Data)
+			} else {
+				value.WriteString(goquery.NewDocumentFromNode(n).Text())
+			}
+		}
+		return false
+	})
+	return strings.Join(strings.Fields(value.String()), " ")
+}
+
+// tableValue procura uma coluna pelo texto do cabeçalho (<th>) e devolve a
+// célula correspondente da primeira linha de dados da mesma tabela.
+func tableValue(sel *goquery.Selection, header string) string {
+	var value string
+	sel.Find("table").EachWithBreak(func(i int, table *goquery.Selection) bool {
+		col := -1
+		table.Find("th").EachWithBreak(func(j int, th *goquery.Selection) bool {
+			if strings.EqualFold(strings.TrimSpace(th.Text()), header) {
+				col = j
+				return false
+			}
+			return true
+		})
+		if col < 0 {
+			return true
+		}
+		cell := table.Find("tbody tr").First().Find("td").Eq(col)
+		value = strings.Join(strings.Fields(cell.Text()), " ")
+		return false
+	})
+	return value
+}
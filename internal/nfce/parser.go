@@ -0,0 +1,140 @@
+package nfce
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/joaogustavosp/loyalty-api/internal/models"
+)
+
+// InvoiceParser extrai a nota e seus produtos da página de consulta do QR Code
+// de um portal da SEFAZ. Cada layout de portal tem a sua implementação.
+type InvoiceParser interface {
+	// Name identifica o layout nos logs e métricas
+	Name() string
+	Parse(doc *goquery.Document) ([]models.ProductInvoice, models.Invoice, error)
+}
+
+// UnsupportedStateError indica que não há parser registrado para a UF ou para o
+// host do portal de consulta.
+type UnsupportedStateError struct {
+	UF   string
+	Host string
+}
+
+func (e *UnsupportedStateError) Error() string {
+	if e.UF == "" {
+		return fmt.Sprintf("portal de consulta %s não suportado", e.Host)
+	}
+	return fmt.Sprintf("UF %s não suportada", e.UF)
+}
+
+// portal descreve um portal de consulta de NFC-e: os hosts onde ele responde,
+// o endereço da consulta pelo QR Code e o parser do seu layout.
+type portal struct {
+	hosts     []string
+	queryPath string
+	parser    InvoiceParser
+}
+
+var (
+	mgPortal = portal{
+		hosts:     []string{"portalsped.fazenda.mg.gov.br", "nfce.fazenda.mg.gov.br"},
+		queryPath: "/portalnfce/sistema/qrcode.xhtml",
+		parser:    mgParser{},
+	}
+	svrsPortal = portal{
+		hosts:     []string{"dfe-portal.svrs.rs.gov.br", "www.sefaz.rs.gov.br"},
+		queryPath: "/Dfe/QrCodeNFce",
+		parser:    svrsParser{},
+	}
+)
+
+// portals relaciona cada UF suportada ao portal de consulta. Os estados que
+// usam o ambiente virtual da SEFAZ-RS (SVRS) ou reproduzem o seu layout
+// compartilham o mesmo parser.
+var portals = map[string]portal{
+	"MG": mgPortal,
+	"RS": svrsPortal,
+	"AC": svrsPortal,
+	"AL": svrsPortal,
+	"AP": svrsPortal,
+	"PB": svrsPortal,
+	"RN": svrsPortal,
+	"RR": svrsPortal,
+	"SE": svrsPortal,
+	"TO": svrsPortal,
+	"SC": {hosts: []string{"sat.sef.sc.gov.br"}, queryPath: "/nfce/consulta", parser: svrsParser{}},
+	"SP": {hosts: []string{"www.nfce.fazenda.sp.gov.br"}, queryPath: "/NFCeConsultaPublica/Paginas/ConsultaQRCode.aspx", parser: svrsParser{}},
+	"PR": {hosts: []string{"www.fazenda.pr.gov.br"}, queryPath: "/nfce/qrcode", parser: svrsParser{}},
+	"BA": {hosts: []string{"nfe.sefaz.ba.gov.br"}, queryPath: "/servicos/nfce/qrcode.aspx", parser: svrsParser{}},
+}
+
+// ParserFor escolhe o parser pelo host da URL de consulta e, se o host não for
+// conhecido, pela UF da chave de acesso.
+func ParserFor(host string, key AccessKey) (InvoiceParser, error) {
+	host = strings.ToLower(host)
+	if host != "" {
+		for _, p := range portals {
+			for _, h := range p.hosts {
+				if host == h {
+					return p.parser, nil
+				}
+			}
+		}
+	}
+
+	if p, ok := portals[key.UF]; ok {
+		return p.parser, nil
+	}
+	return nil, &UnsupportedStateError{UF: key.UF, Host: host}
+}
+
+// QueryURL monta a URL de consulta da nota no portal da UF da chave, como a
+// do QR Code versão 3 emitido online em produção, que dispensa o hash.
+func QueryURL(key AccessKey) (string, error) {
+	p, ok := portals[key.UF]
+	if !ok {
+		return "", &UnsupportedStateError{UF: key.UF}
+	}
+	return "https://" + p.hosts[0] + p.queryPath + "?p=" + key.Key + "|3|1", nil
+}
+
+// parseMoney converte um valor exibido no portal, devolvendo zero quando o
+// texto não contém um número. Campos ausentes são apontados depois pela
+// conferência dos totais.
+func parseMoney(s string) models.Money {
+	v, err := models.ParseMoney(reNumber.FindString(s))
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+// parseRequiredMoney converte um valor obrigatório da página. ok indica se o
+// texto continha um número, para distinguir um item gratuito, de valor zero,
+// de um campo que o parser não encontrou.
+func parseRequiredMoney(s string) (models.Money, bool) {
+	v, err := models.ParseMoney(reNumber.FindString(s))
+	return v, err == nil
+}
+
+// parseQuantity converte uma quantidade exibida no portal, devolvendo zero
+// quando o texto não contém um número.
+func parseQuantity(s string) models.Quantity {
+	v, err := models.ParseQuantity(reNumber.FindString(s))
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+// PortalHosts devolve, por UF, os hosts dos portais de consulta conhecidos.
+func PortalHosts() map[string][]string {
+	hosts := make(map[string][]string, len(portals))
+	for uf, p := range portals {
+		hosts[uf] = append([]string(nil), p.hosts...)
+	}
+	return hosts
+}
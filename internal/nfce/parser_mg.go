@@ -0,0 +1,97 @@
+package nfce
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/joaogustavosp/loyalty-api/internal/models"
+)
+
+var (
+	// Expressão regular para extrair apenas números, pontos e vírgulas
+	reNumber = regexp.MustCompile(`\d[0-9,.]*`)
+	// Expressão regular para extrair o código
+	reCode = regexp.MustCompile(`Código: ?(\d+)`)
+	// Expressão regular para extrair o GTIN, quando o portal o exibe
+	reGTIN = regexp.MustCompile(`(?:GTIN|EAN)(?: Comercial)?: ?(\d+|SEM GTIN)`)
+	// Expressão regular para extrair o NCM, quando o portal o exibe
+	reNCM = regexp.MustCompile(`NCM: ?(\d{4}\.?\d{2}\.?\d{2})`)
+	// Expressão regular para extrair o CNPJ, numérico ou alfanumérico
+	reCNPJ = regexp.MustCompile(`CNPJ: ?([0-9A-Z]{2}\.[0-9A-Z]{3}\.[0-9A-Z]{3}\/[0-9A-Z]{4}\-\d{2})`)
+)
+
+// mgParser lê o layout do portal da SEFAZ-MG, que organiza a nota em painéis
+// colapsáveis e lista os produtos em table.table-striped.
+type mgParser struct{}
+
+func (mgParser) Name() string { return "mg" }
+
+func (mgParser) Parse(doc *goquery.Document) ([]models.ProductInvoice, models.Invoice, error) {
+	var productInvoices []models.ProductInvoice
+	var invoice models.Invoice
+
+	// Encontrar o elemento com id="collapse4" e extrair os dados da nota
+	collapse4 := doc.Find("#collapse4")
+	invoice.InvoiceNumber = strings.TrimSpace(collapse4.Find("table:nth-child(8) > tbody > tr > td:nth-child(3)").Text())
+	invoice.IssueDate = strings.TrimSpace(collapse4.Find("table:nth-child(8) > tbody > tr > td:nth-child(4)").Text())
+	cnpjText := doc.Find("td:contains('CNPJ')").Text()
+	cnpj := reCNPJ.FindStringSubmatch(cnpjText)
+	if len(cnpj) > 1 {
+		invoice.CNPJ = cnpj[1]
+	}
+
+	// Cabeçalho do emitente: razão social no título, CNPJ e inscrição estadual
+	// na primeira linha e o endereço na seguinte
+	header := doc.Find("td:contains('CNPJ')").First().Closest("table")
+	invoice.Merchant = models.Merchant{
+		CNPJ:      invoice.CNPJ,
+		Name:      strings.TrimSpace(header.Find("th").First().Text()),
+		TradeName: tableValue(doc.Selection, "Nome Fantasia"),
+		Address:   parseAddressLine(header.Find("tbody tr").Eq(1).Text()),
+	}
+	if ie := reIE.FindStringSubmatch(cnpjText); len(ie) > 1 {
+		invoice.Merchant.StateRegistration = ie[1]
+	}
+
+	// Selecionar e extrair os dados dos produtos
+	doc.Find("table.table-striped tbody tr").Each(func(i int, s *goquery.Selection) {
+		codeText := s.Find("td:nth-child(1)").Text()
+		code := reCode.FindStringSubmatch(codeText)
+		if len(code) > 1 {
+			codeText = code[1]
+		} else {
+			codeText = ""
+		}
+
+		value, ok := parseRequiredMoney(s.Find("td:nth-child(4)").Text())
+		if !ok {
+			invoice.Missing = append(invoice.Missing, fmt.Sprintf("products[%d].value", len(productInvoices)))
+		}
+
+		productInvoice := models.ProductInvoice{
+			Name:     strings.TrimSpace(s.Find("td:nth-child(1) h7").Text()),
+			Code:     codeText,
+			GTIN:     findGTIN(s.Find("td:nth-child(1)").Text(), codeText),
+			NCM:      findNCM(s.Find("td:nth-child(1)").Text()),
+			Quantity: parseQuantity(s.Find("td:nth-child(2)").Text()),
+			Unit:     strings.TrimSpace(s.Find("td:nth-child(3)").Text()),
+			Value:    value,
+		}
+		productInvoices = append(productInvoices, productInvoice)
+	})
+
+	// Os totais e pagamentos ficam numa tabela de duas colunas após os produtos
+	inPayments := false
+	doc.Find("table.table-hover tr").Each(func(i int, s *goquery.Selection) {
+		label := s.Find("td:nth-child(1)").Text()
+		if strings.Contains(strings.ToLower(label), "forma de pagamento") {
+			inPayments = true
+			return
+		}
+		readTotalsLine(&invoice, label, s.Find("td:nth-child(2)").Text(), inPayments)
+	})
+
+	return productInvoices, invoice, nil
+}
@@ -0,0 +1,90 @@
+package nfce
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/joaogustavosp/loyalty-api/internal/models"
+)
+
+var (
+	reSVRSNumber = regexp.MustCompile(`Número:\s*(\d+)`)
+	reSVRSIssue  = regexp.MustCompile(`Emissão:\s*(\d{2}/\d{2}/\d{4}\s+\d{2}:\d{2}:\d{2})`)
+)
+
+// svrsParser lê o layout padrão da consulta de NFC-e do ambiente virtual da
+// SEFAZ-RS, com os produtos em #tabResult e os dados da nota em #infos.
+type svrsParser struct{}
+
+func (svrsParser) Name() string { return "svrs" }
+
+func (svrsParser) Parse(doc *goquery.Document) ([]models.ProductInvoice, models.Invoice, error) {
+	var productInvoices []models.ProductInvoice
+	var invoice models.Invoice
+
+	// Cabeçalho com razão social, CNPJ e endereço do emitente
+	header := doc.Find(".txtCenter")
+	cnpj := reCNPJ.FindStringSubmatch(header.Find(".text").Text())
+	if len(cnpj) > 1 {
+		invoice.CNPJ = cnpj[1]
+	}
+	invoice.Merchant = models.Merchant{
+		CNPJ:              invoice.CNPJ,
+		Name:              strings.TrimSpace(header.Find(".txtTopo").First().Text()),
+		TradeName:         labeledValue(doc.Find("#infos"), "Nome Fantasia"),
+		StateRegistration: labeledValue(doc.Find("#infos"), "Inscrição Estadual"),
+		Address:           parseAddressLine(header.Find(".text").Eq(1).Text()),
+	}
+
+	info := doc.Find("#infos").Text()
+	if m := reSVRSNumber.FindStringSubmatch(info); len(m) > 1 {
+		invoice.InvoiceNumber = m[1]
+	}
+	if m := reSVRSIssue.FindStringSubmatch(info); len(m) > 1 {
+		invoice.IssueDate = m[1]
+	}
+
+	doc.Find("#tabResult tr").Each(func(i int, s *goquery.Selection) {
+		name := strings.TrimSpace(s.Find(".txtTit").First().Text())
+		if name == "" {
+			return
+		}
+
+		var codeText string
+		if code := reCode.FindStringSubmatch(s.Find(".RCod").Text()); len(code) > 1 {
+			codeText = code[1]
+		}
+
+		value, ok := parseRequiredMoney(s.Find(".valor").Text())
+		if !ok {
+			invoice.Missing = append(invoice.Missing, fmt.Sprintf("products[%d].value", len(productInvoices)))
+		}
+
+		productInvoice := models.ProductInvoice{
+			Name:      name,
+			Code:      codeText,
+			GTIN:      findGTIN(s.Find(".RCod").Parent().Text(), codeText),
+			NCM:       findNCM(s.Find(".RCod").Parent().Text()),
+			Quantity:  parseQuantity(s.Find(".Rqtd").Text()),
+			Unit:      strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(s.Find(".RUN").Text()), "UN:")),
+			UnitPrice: parseMoney(s.Find(".RvlUnit").Text()),
+			Value:     value,
+		}
+		productInvoices = append(productInvoices, productInvoice)
+	})
+
+	// O bloco de totais repete id="linhaTotal" em cada linha, e #linhaForma
+	// separa os totais dos pagamentos
+	inPayments := false
+	doc.Find("#totalNota > div").Each(func(i int, s *goquery.Selection) {
+		if s.Is("#linhaForma") {
+			inPayments = true
+			return
+		}
+		readTotalsLine(&invoice, s.Find("label").Text(), s.Find(".totalNumb").Text(), inPayments)
+	})
+
+	return productInvoices, invoice, nil
+}
@@ -0,0 +1,94 @@
+package nfce
+
+import (
+	"strings"
+
+	"github.com/joaogustavosp/loyalty-api/internal/models"
+)
+
+// paymentCodes mapeia os códigos tPag da NF-e para as formas de pagamento.
+var paymentCodes = map[string]models.PaymentMethod{
+	"01": models.PaymentCash,
+	"03": models.PaymentCreditCard,
+	"04": models.PaymentDebitCard,
+	"10": models.PaymentMealVoucher,
+	"11": models.PaymentMealVoucher,
+	"17": models.PaymentPix,
+	"20": models.PaymentPix,
+}
+
+// paymentDescriptions são as descrições de cada tPag como exibidas nos portais.
+var paymentDescriptions = map[string]string{
+	"01": "Dinheiro",
+	"02": "Cheque",
+	"03": "Cartão de Crédito",
+	"04": "Cartão de Débito",
+	"05": "Crédito Loja",
+	"10": "Vale Alimentação",
+	"11": "Vale Refeição",
+	"12": "Vale Presente",
+	"13": "Vale Combustível",
+	"15": "Boleto Bancário",
+	"16": "Depósito Bancário",
+	"17": "Pagamento Instantâneo (PIX)",
+	"18": "Transferência bancária, Carteira Digital",
+	"19": "Programa de fidelidade, Cashback, Crédito Virtual",
+	"20": "Pagamento Instantâneo (PIX) - Estático",
+	"90": "Sem pagamento",
+	"99": "Outros",
+}
+
+// PaymentMethodFromCode converte o código tPag do XML da NF-e.
+func PaymentMethodFromCode(code string) models.PaymentMethod {
+	if method, ok := paymentCodes[strings.TrimSpace(code)]; ok {
+		return method
+	}
+	return models.PaymentOther
+}
+
+// PaymentMethodFromLabel converte a descrição da forma de pagamento exibida
+// nos portais, como "Cartão de Crédito" ou "Pagamento Instantâneo (PIX)".
+func PaymentMethodFromLabel(label string) models.PaymentMethod {
+	l := strings.ToLower(label)
+	switch {
+	case strings.Contains(l, "pix") || strings.Contains(l, "instantâneo"):
+		return models.PaymentPix
+	case strings.Contains(l, "crédito") || strings.Contains(l, "credito"):
+		return models.PaymentCreditCard
+	case strings.Contains(l, "débito") || strings.Contains(l, "debito"):
+		return models.PaymentDebitCard
+	case strings.Contains(l, "dinheiro"):
+		return models.PaymentCash
+	case strings.Contains(l, "vale alimenta") || strings.Contains(l, "vale refei"):
+		return models.PaymentMealVoucher
+	}
+	return models.PaymentOther
+}
+
+// readTotalsLine interpreta uma linha "rótulo / valor" do bloco de totais e
+// pagamentos. Depois do cabeçalho "Forma de pagamento" as linhas são
+// pagamentos, exceto o troco e os tributos.
+func readTotalsLine(invoice *models.Invoice, label, value string, inPayments bool) {
+	label = strings.Join(strings.Fields(label), " ")
+	l := strings.ToLower(label)
+	amount := parseMoney(value)
+
+	switch {
+	case strings.HasPrefix(l, "troco"):
+		invoice.Change = amount
+	case strings.Contains(l, "tributos"):
+		invoice.Totals.ApproximateTaxes = amount
+	case inPayments:
+		invoice.Payments = append(invoice.Payments, models.Payment{
+			Method:      PaymentMethodFromLabel(label),
+			Description: strings.TrimSuffix(label, ":"),
+			Amount:      amount,
+		})
+	case strings.HasPrefix(l, "valor total"):
+		invoice.Totals.Gross = amount
+	case strings.HasPrefix(l, "desconto") || strings.HasPrefix(l, "valor descontos"):
+		invoice.Totals.Discount = amount
+	case strings.HasPrefix(l, "valor a pagar") || strings.HasPrefix(l, "valor pago"):
+		invoice.Totals.Net = amount
+	}
+}
@@ -0,0 +1,156 @@
+package nfce
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/joaogustavosp/loyalty-api/internal/models"
+)
+
+// Ambientes de emissão (tpAmb) informados no QR Code
+const (
+	EnvironmentProduction   = "1"
+	EnvironmentHomologation = "2"
+)
+
+// EmissionTypeOffline é o tpEmis das NFC-e emitidas em contingência offline,
+// que só chegam à SEFAZ quando o estabelecimento as transmite.
+const EmissionTypeOffline = "9"
+
+// QRPayload é o conteúdo da URL do QR Code de uma NFC-e decomposto. As versões
+// 2 e 3 trazem os campos no parâmetro p separados por "|"; a versão 1 usa
+// parâmetros próprios. Os campos da emissão offline (dia, valor e digest ou
+// assinatura) só existem nas notas em contingência.
+type QRPayload struct {
+	AccessKey   AccessKey
+	Version     int
+	Environment string
+	Offline     bool
+	// IssueDay é o dia do mês da emissão, informado apenas offline
+	IssueDay    int
+	Total       models.Money
+	DigestValue string
+	TokenID     string
+	Hash        string
+	// Signature substitui o hash na versão 3 offline
+	Signature string
+}
+
+// Contingency indica se a nota foi emitida em contingência offline.
+func (p QRPayload) Contingency() bool {
+	return p.Offline || p.AccessKey.EmissionType == EmissionTypeOffline
+}
+
+// ParseQRPayload lê a URL de consulta do QR Code em qualquer das versões.
+//
+//	v1:         ?chNFe=chave&nVersao=100&tpAmb=1&dhEmi=...&vNF=...&digVal=...&cIdToken=...&cHashQRCode=...
+//	v2 online:  ?p=chave|2|tpAmb|cIdToken|hash
+//	v2 offline: ?p=chave|2|tpAmb|dia|vNF|digVal|cIdToken|hash
+//	v3 online:  ?p=chave|3|tpAmb
+//	v3 offline: ?p=chave|3|tpAmb|dia|vNF|tpIdDest|idDest|assinatura
+func ParseQRPayload(rawURL string) (QRPayload, error) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return QRPayload{}, fmt.Errorf("%w: URL inválida", ErrInvalidAccessKey)
+	}
+
+	query := parsedURL.Query()
+	if p := query.Get("p"); p != "" {
+		return parsePipePayload(p)
+	}
+	if query.Get("chNFe") != "" {
+		return parseV1Payload(query)
+	}
+	return QRPayload{}, fmt.Errorf("%w: parâmetro p não encontrado na URL", ErrInvalidAccessKey)
+}
+
+func parsePipePayload(p string) (QRPayload, error) {
+	fields := strings.Split(p, "|")
+	key, err := ParseAccessKey(fields[0])
+	if err != nil {
+		return QRPayload{}, err
+	}
+	payload := QRPayload{AccessKey: key}
+	// Só a chave: formato aceito pelos portais e montado por QueryURL
+	if len(fields) < 3 {
+		return payload, nil
+	}
+
+	payload.Version, err = strconv.Atoi(fields[1])
+	if err != nil {
+		return QRPayload{}, fmt.Errorf("%w: versão do QR Code %q inválida", ErrInvalidAccessKey, fields[1])
+	}
+	payload.Environment = fields[2]
+	rest := fields[3:]
+
+	switch payload.Version {
+	case 2:
+		switch len(rest) {
+		case 2:
+			payload.TokenID, payload.Hash = rest[0], rest[1]
+		case 5:
+			payload.Offline = true
+			payload.DigestValue, payload.TokenID, payload.Hash = rest[2], rest[3], rest[4]
+		default:
+			return QRPayload{}, fmt.Errorf("%w: QR Code versão 2 com %d campos após o ambiente", ErrInvalidAccessKey, len(rest))
+		}
+	case 3:
+		switch len(rest) {
+		case 0:
+		case 3, 5:
+			// O destinatário (tpIdDest e idDest) é opcional
+			payload.Offline = true
+			payload.Signature = rest[len(rest)-1]
+		default:
+			return QRPayload{}, fmt.Errorf("%w: QR Code versão 3 com %d campos após o ambiente", ErrInvalidAccessKey, len(rest))
+		}
+	default:
+		return QRPayload{}, fmt.Errorf("%w: versão do QR Code %d não suportada", ErrInvalidAccessKey, payload.Version)
+	}
+
+	if payload.Offline {
+		if payload.IssueDay, err = strconv.Atoi(rest[0]); err != nil || payload.IssueDay < 1 || payload.IssueDay > 31 {
+			return QRPayload{}, fmt.Errorf("%w: dia de emissão %q inválido", ErrInvalidAccessKey, rest[0])
+		}
+		if payload.Total, err = models.ParseMoneyDecimal(rest[1]); err != nil {
+			return QRPayload{}, fmt.Errorf("%w: valor da nota %q inválido", ErrInvalidAccessKey, rest[1])
+		}
+	}
+	return payload, nil
+}
+
+func parseV1Payload(query url.Values) (QRPayload, error) {
+	key, err := ParseAccessKey(query.Get("chNFe"))
+	if err != nil {
+		return QRPayload{}, err
+	}
+	payload := QRPayload{
+		AccessKey:   key,
+		Version:     1,
+		Environment: query.Get("tpAmb"),
+		DigestValue: query.Get("digVal"),
+		TokenID:     query.Get("cIdToken"),
+		Hash:        query.Get("cHashQRCode"),
+	}
+	if vNF := query.Get("vNF"); vNF != "" {
+		if payload.Total, err = models.ParseMoneyDecimal(vNF); err != nil {
+			return QRPayload{}, fmt.Errorf("%w: valor da nota %q inválido", ErrInvalidAccessKey, vNF)
+		}
+	}
+	return payload, nil
+}
+
+// Check confere os dados da emissão offline presentes no QR Code com a nota
+// consultada, devolvendo os campos divergentes para os warnings.
+func (p QRPayload) Check(invoice models.Invoice) []string {
+	var warnings []string
+	if p.Total > 0 && abs(p.Total-invoice.Totals.Net) > totalsTolerance {
+		warnings = append(warnings, "qrcode.total")
+	}
+	if p.IssueDay > 0 && invoice.IssuedAt != nil && invoice.IssuedAt.Day() != p.IssueDay {
+		warnings = append(warnings, "qrcode.issue_day")
+	}
+	return warnings
+}
@@ -0,0 +1,63 @@
+package nfce
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"strings"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/qrcode"
+)
+
+var (
+	ErrInvalidImage   = errors.New("imagem inválida, envie JPEG ou PNG")
+	ErrQRCodeNotFound = errors.New("QR Code da NFC-e não encontrado na imagem")
+)
+
+// maxImagePixels limita a resolução das fotos decodificadas. Um PNG pequeno
+// pode declarar dimensões enormes e ocupar gigabytes depois de descomprimido.
+const maxImagePixels = 24_000_000
+
+// DecodeQRCodeImage localiza e decodifica o QR Code de uma foto do cupom,
+// devolvendo a URL de consulta impressa nele.
+func DecodeQRCodeImage(r io.Reader) (string, error) {
+	// Ler as dimensões do cabeçalho antes de alocar a imagem
+	var header bytes.Buffer
+	cfg, _, err := image.DecodeConfig(io.TeeReader(r, &header))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > maxImagePixels {
+		return "", fmt.Errorf("%w: resolução %dx%d acima do permitido", ErrInvalidImage, cfg.Width, cfg.Height)
+	}
+
+	img, _, err := image.Decode(io.MultiReader(&header, r))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+
+	bmp, err := gozxing.NewBinaryBitmapFromImage(img)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+
+	hints := map[gozxing.DecodeHintType]interface{}{
+		gozxing.DecodeHintType_TRY_HARDER: true,
+	}
+	result, err := qrcode.NewQRCodeReader().Decode(bmp, hints)
+	if err != nil {
+		return "", ErrQRCodeNotFound
+	}
+
+	// O QR Code da NFC-e sempre contém a URL de consulta do portal
+	text := strings.TrimSpace(result.GetText())
+	if !strings.HasPrefix(strings.ToLower(text), "http") {
+		return "", ErrQRCodeNotFound
+	}
+	return text, nil
+}
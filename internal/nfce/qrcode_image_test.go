@@ -0,0 +1,59 @@
+package nfce
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/qrcode"
+)
+
+func TestDecodeQRCodeImage(t *testing.T) {
+	const url = "https://www.nfce.fazenda.sp.gov.br/qrcode?p=35230512345678000195650010000123451000123454|2|1|1|ABCDEF"
+	matrix, err := qrcode.NewQRCodeWriter().Encode(url, gozxing.BarcodeFormat_QR_CODE, 300, 300, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, matrix); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := DecodeQRCodeImage(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != url {
+		t.Errorf("DecodeQRCodeImage = %q, want %q", got, url)
+	}
+}
+
+func TestDecodeQRCodeImageRejectsHugeDimensions(t *testing.T) {
+	// PNG de 1x1 com o cabeçalho reescrito para 100000x100000
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	binary.BigEndian.PutUint32(data[16:20], 100000)
+	binary.BigEndian.PutUint32(data[20:24], 100000)
+	binary.BigEndian.PutUint32(data[29:33], crc32.ChecksumIEEE(data[12:29]))
+
+	_, err := DecodeQRCodeImage(bytes.NewReader(data))
+	if !errors.Is(err, ErrInvalidImage) || !strings.Contains(err.Error(), "100000x100000") {
+		t.Fatalf("err = %v, want ErrInvalidImage pela resolução", err)
+	}
+}
+
+func TestDecodeQRCodeImageInvalid(t *testing.T) {
+	_, err := DecodeQRCodeImage(bytes.NewReader([]byte("não é imagem")))
+	if !errors.Is(err, ErrInvalidImage) {
+		t.Fatalf("err = %v, want ErrInvalidImage", err)
+	}
+}
@@ -0,0 +1,86 @@
+package nfce
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseQRPayload(t *testing.T) {
+	const (
+		host = "https://www.nfce.fazenda.sp.gov.br/qrcode"
+		key  = "35230512345678000195650010000123451000123454"
+	)
+	tests := []struct {
+		name    string
+		url     string
+		want    QRPayload
+		wantErr string
+	}{
+		{
+			name: "versão 2 online",
+			url:  host + "?p=" + key + "|2|1|1|ABCDEF",
+			want: QRPayload{Version: 2, Environment: "1", TokenID: "1", Hash: "ABCDEF"},
+		},
+		{
+			name: "versão 2 offline",
+			url:  host + "?p=" + key + "|2|1|15|25.66|6162636465|1|ABCDEF",
+			want: QRPayload{Version: 2, Environment: "1", Offline: true, IssueDay: 15, Total: 2566, DigestValue: "6162636465", TokenID: "1", Hash: "ABCDEF"},
+		},
+		{
+			name: "versão 3 online",
+			url:  host + "?p=" + key + "|3|1",
+			want: QRPayload{Version: 3, Environment: "1"},
+		},
+		{
+			name: "versão 3 offline sem destinatário",
+			url:  host + "?p=" + key + "|3|1|15|25.66|ASSINATURA",
+			want: QRPayload{Version: 3, Environment: "1", Offline: true, IssueDay: 15, Total: 2566, Signature: "ASSINATURA"},
+		},
+		{
+			name: "versão 3 offline com destinatário",
+			url:  host + "?p=" + key + "|3|1|15|25.66|1|52998224725|ASSINATURA",
+			want: QRPayload{Version: 3, Environment: "1", Offline: true, IssueDay: 15, Total: 2566, Signature: "ASSINATURA"},
+		},
+		{
+			name: "só a chave",
+			url:  host + "?p=" + key,
+			want: QRPayload{},
+		},
+		{
+			name: "versão 1",
+			url:  host + "?chNFe=" + key + "&nVersao=100&tpAmb=1&vNF=25.66&digVal=abc&cIdToken=000001&cHashQRCode=HASH",
+			want: QRPayload{Version: 1, Environment: "1", Total: 2566, DigestValue: "abc", TokenID: "000001", Hash: "HASH"},
+		},
+		{name: "versão 2 com campos de menos", url: host + "?p=" + key + "|2|1|1", wantErr: "versão 2 com 1 campos"},
+		{name: "versão 2 com campos demais", url: host + "?p=" + key + "|2|1|1|2|3|4|5|6", wantErr: "versão 2 com 6 campos"},
+		{name: "versão 3 com campos errados", url: host + "?p=" + key + "|3|1|15|25.66", wantErr: "versão 3 com 2 campos"},
+		{name: "versão desconhecida", url: host + "?p=" + key + "|4|1", wantErr: "versão do QR Code 4"},
+		{name: "versão inválida", url: host + "?p=" + key + "|x|1", wantErr: "versão do QR Code \"x\""},
+		{name: "dia offline inválido", url: host + "?p=" + key + "|3|1|32|25.66|ASSINATURA", wantErr: "dia de emissão"},
+		{name: "valor offline inválido", url: host + "?p=" + key + "|3|1|15|abc|ASSINATURA", wantErr: "valor da nota"},
+		{name: "sem parâmetro p", url: host + "?q=1", wantErr: "parâmetro p"},
+		{name: "chave inválida", url: host + "?p=123|2|1|1|ABCDEF", wantErr: "44 dígitos"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseQRPayload(tt.url)
+			if tt.wantErr != "" {
+				if !errors.Is(err, ErrInvalidAccessKey) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.AccessKey.Key != key {
+				t.Errorf("chave = %q", got.AccessKey.Key)
+			}
+			got.AccessKey = AccessKey{}
+			if got != tt.want {
+				t.Errorf("ParseQRPayload = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
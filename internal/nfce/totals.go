@@ -0,0 +1,91 @@
+package nfce
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/joaogustavosp/loyalty-api/internal/models"
+)
+
+var ErrTotalsMismatch = errors.New("totais da nota não conferem com os produtos")
+
+// totalsTolerance absorve os arredondamentos de um centavo que os portais
+// fazem por linha.
+const totalsTolerance models.Money = 1
+
+// ReconcileTotals completa os valores que o portal não exibe (preço unitário e
+// totais da nota) e confere os totais informados contra a soma das linhas e
+// dos pagamentos. O valor pago é o bruto menos os descontos mais os
+// acréscimos, que só o XML informa.
+func ReconcileTotals(invoice *models.Invoice, products []models.ProductInvoice) error {
+	var gross, lineDiscounts models.Money
+	for i := range products {
+		p := &products[i]
+		if p.UnitPrice == 0 && p.Quantity > 0 {
+			p.UnitPrice = p.Value.DivQuantity(p.Quantity)
+		}
+		if p.Quantity > 0 && abs(p.Quantity.Times(p.UnitPrice)-p.Value) > lineTolerance(p.Quantity) {
+			return fmt.Errorf("%w: item %d (%s) com quantidade %s x %s diferente de %s",
+				ErrTotalsMismatch, i+1, p.Name, p.Quantity, p.UnitPrice, p.Value)
+		}
+		gross += p.Value
+		lineDiscounts += p.Discount
+	}
+
+	totals := &invoice.Totals
+	if totals.Gross == 0 && totals.Net == 0 {
+		totals.Gross = gross
+		totals.Discount = lineDiscounts
+		totals.Net = gross - lineDiscounts
+		return checkPayments(invoice)
+	}
+
+	if totals.Gross == 0 {
+		totals.Gross = totals.Net + totals.Discount - totals.Surcharges
+	}
+	if totals.Net == 0 {
+		totals.Net = totals.Gross - totals.Discount + totals.Surcharges
+	}
+
+	if abs(totals.Gross-gross) > totalsTolerance {
+		return fmt.Errorf("%w: total %s diferente da soma dos itens %s", ErrTotalsMismatch, totals.Gross, gross)
+	}
+	if lineDiscounts > 0 && abs(totals.Discount-lineDiscounts) > totalsTolerance {
+		return fmt.Errorf("%w: desconto %s diferente da soma dos descontos dos itens %s", ErrTotalsMismatch, totals.Discount, lineDiscounts)
+	}
+	if abs(totals.Gross-totals.Discount+totals.Surcharges-totals.Net) > totalsTolerance {
+		return fmt.Errorf("%w: total %s menos desconto %s mais acréscimos %s diferente do valor pago %s",
+			ErrTotalsMismatch, totals.Gross, totals.Discount, totals.Surcharges, totals.Net)
+	}
+	return checkPayments(invoice)
+}
+
+// checkPayments confere a soma dos pagamentos, descontado o troco, contra o
+// valor pago. Notas sem pagamentos listados não são conferidas.
+func checkPayments(invoice *models.Invoice) error {
+	if len(invoice.Payments) == 0 {
+		return nil
+	}
+	var paid models.Money
+	for _, p := range invoice.Payments {
+		paid += p.Amount
+	}
+	if abs(paid-invoice.Change-invoice.Totals.Net) > totalsTolerance {
+		return fmt.Errorf("%w: pagamentos %s menos troco %s diferente do valor pago %s", ErrTotalsMismatch, paid, invoice.Change, invoice.Totals.Net)
+	}
+	return nil
+}
+
+// lineTolerance admite, além do centavo, meio centavo por unidade vendida: o
+// preço unitário pode ter mais casas do que os centavos guardados em Money,
+// como nos combustíveis.
+func lineTolerance(q models.Quantity) models.Money {
+	return totalsTolerance + models.Money(int64(q)/int64(2*models.QuantityUnit))
+}
+
+func abs(m models.Money) models.Money {
+	if m < 0 {
+		return -m
+	}
+	return m
+}
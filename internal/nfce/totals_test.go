@@ -0,0 +1,174 @@
+package nfce
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/joaogustavosp/loyalty-api/internal/models"
+)
+
+func TestReconcileTotals(t *testing.T) {
+	unit := models.QuantityUnit
+	tests := []struct {
+		name     string
+		invoice  models.Invoice
+		products []models.ProductInvoice
+		wantErr  bool
+		want     models.InvoiceTotals
+	}{
+		{
+			name: "totais calculados a partir das linhas",
+			products: []models.ProductInvoice{
+				{Name: "ARROZ", Quantity: 2 * unit, UnitPrice: 1250, Value: 2500, Discount: 100},
+				{Name: "FEIJAO", Quantity: unit, UnitPrice: 899, Value: 899},
+			},
+			want: models.InvoiceTotals{Gross: 3399, Discount: 100, Net: 3299},
+		},
+		{
+			name: "preço unitário derivado com dízima",
+			invoice: models.Invoice{
+				Totals: models.InvoiceTotals{Gross: 1000, Net: 1000},
+			},
+			products: []models.ProductInvoice{{Name: "BALA", Quantity: 30 * unit, Value: 1000}},
+			want:     models.InvoiceTotals{Gross: 1000, Net: 1000},
+		},
+		{
+			name: "combustível com preço de três casas",
+			invoice: models.Invoice{
+				Totals:   models.InvoiceTotals{Gross: 23669, Net: 23669},
+				Payments: []models.Payment{{Method: models.PaymentDebitCard, Amount: 23669}},
+			},
+			// 40,123 L x R$ 5,899 = 236,69; o preço guardado em Money é 5,90
+			products: []models.ProductInvoice{{Name: "GASOLINA", Quantity: 401230, UnitPrice: 590, Value: 23669}},
+			want:     models.InvoiceTotals{Gross: 23669, Net: 23669},
+		},
+		{
+			name: "item gratuito",
+			products: []models.ProductInvoice{
+				{Name: "BRINDE", Quantity: unit, Value: 0},
+				{Name: "CAFE", Quantity: unit, UnitPrice: 1590, Value: 1590},
+			},
+			want: models.InvoiceTotals{Gross: 1590, Net: 1590},
+		},
+		{
+			name: "total informado absorve arredondamento de um centavo",
+			invoice: models.Invoice{
+				Totals: models.InvoiceTotals{Gross: 1001, Discount: 0},
+			},
+			products: []models.ProductInvoice{{Name: "PAO", Quantity: unit, UnitPrice: 1000, Value: 1000}},
+			want:     models.InvoiceTotals{Gross: 1001, Net: 1001},
+		},
+		{
+			name: "acréscimos do XML entram no valor pago",
+			invoice: models.Invoice{
+				Totals:   models.InvoiceTotals{Gross: 4000, Surcharges: 400, Net: 4400},
+				Payments: []models.Payment{{Method: models.PaymentCreditCard, Amount: 4400}},
+			},
+			products: []models.ProductInvoice{{Name: "PRATO", Quantity: unit, UnitPrice: 4000, Value: 4000}},
+			want:     models.InvoiceTotals{Gross: 4000, Surcharges: 400, Net: 4400},
+		},
+		{
+			name: "bruto derivado do valor pago com acréscimos",
+			invoice: models.Invoice{
+				Totals: models.InvoiceTotals{Discount: 100, Surcharges: 500, Net: 1400},
+			},
+			products: []models.ProductInvoice{{Name: "PAO", Quantity: unit, UnitPrice: 1000, Value: 1000, Discount: 100}},
+			want:     models.InvoiceTotals{Gross: 1000, Discount: 100, Surcharges: 500, Net: 1400},
+		},
+		{
+			name: "valor pago sem os acréscimos",
+			invoice: models.Invoice{
+				Totals: models.InvoiceTotals{Gross: 4000, Surcharges: 400, Net: 4000},
+			},
+			products: []models.ProductInvoice{{Name: "PRATO", Quantity: unit, UnitPrice: 4000, Value: 4000}},
+			wantErr:  true,
+		},
+		{
+			name:     "linha não confere",
+			products: []models.ProductInvoice{{Name: "LEITE", Quantity: 2 * unit, UnitPrice: 500, Value: 1500}},
+			wantErr:  true,
+		},
+		{
+			name: "total diferente da soma dos itens",
+			invoice: models.Invoice{
+				Totals: models.InvoiceTotals{Gross: 2000, Net: 2000},
+			},
+			products: []models.ProductInvoice{{Name: "PAO", Quantity: unit, UnitPrice: 1000, Value: 1000}},
+			wantErr:  true,
+		},
+		{
+			name: "desconto diferente do desconto dos itens",
+			invoice: models.Invoice{
+				Totals: models.InvoiceTotals{Gross: 1000, Discount: 300, Net: 700},
+			},
+			products: []models.ProductInvoice{{Name: "PAO", Quantity: unit, UnitPrice: 1000, Value: 1000, Discount: 100}},
+			wantErr:  true,
+		},
+		{
+			name: "pagamentos menos troco diferente do valor pago",
+			invoice: models.Invoice{
+				Totals:   models.InvoiceTotals{Gross: 1000, Net: 1000},
+				Payments: []models.Payment{{Method: models.PaymentCash, Amount: 2000}},
+				Change:   500,
+			},
+			products: []models.ProductInvoice{{Name: "PAO", Quantity: unit, UnitPrice: 1000, Value: 1000}},
+			wantErr:  true,
+		},
+		{
+			name: "pagamento em dinheiro com troco",
+			invoice: models.Invoice{
+				Totals:   models.InvoiceTotals{Gross: 1000, Net: 1000},
+				Payments: []models.Payment{{Method: models.PaymentCash, Amount: 2000}},
+				Change:   1000,
+			},
+			products: []models.ProductInvoice{{Name: "PAO", Quantity: unit, UnitPrice: 1000, Value: 1000}},
+			want:     models.InvoiceTotals{Gross: 1000, Net: 1000},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invoice := tt.invoice
+			err := ReconcileTotals(&invoice, tt.products)
+			if tt.wantErr {
+				if !errors.Is(err, ErrTotalsMismatch) {
+					t.Fatalf("err = %v, want ErrTotalsMismatch", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("err = %v", err)
+			}
+			if invoice.Totals != tt.want {
+				t.Errorf("totais = %+v, want %+v", invoice.Totals, tt.want)
+			}
+		})
+	}
+}
+
+func TestReconcileTotalsDerivesUnitPrice(t *testing.T) {
+	products := []models.ProductInvoice{{Name: "BALA", Quantity: 30 * models.QuantityUnit, Value: 1000}}
+	var invoice models.Invoice
+	if err := ReconcileTotals(&invoice, products); err != nil {
+		t.Fatal(err)
+	}
+	if products[0].UnitPrice != 33 {
+		t.Errorf("preço unitário = %s, want 0,33", products[0].UnitPrice)
+	}
+}
+
+func TestLineTolerance(t *testing.T) {
+	tests := []struct {
+		q    models.Quantity
+		want models.Money
+	}{
+		{models.QuantityUnit, 1},
+		{2 * models.QuantityUnit, 2},
+		{30 * models.QuantityUnit, 16},
+		{3565, 1},
+	}
+	for _, tt := range tests {
+		if got := lineTolerance(tt.q); got != tt.want {
+			t.Errorf("lineTolerance(%s) = %d, want %d", tt.q, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package nfce
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/joaogustavosp/loyalty-api/internal/models"
+	"github.com/joaogustavosp/loyalty-api/pkg/utils"
+)
+
+var ErrInvalidXML = errors.New("XML de NF-e inválido")
+
+// nfeProc reproduz os campos do leiaute 4.00 da NF-e/NFC-e usados pela
+// extração. As tags são casadas pelo nome local, sem o namespace do portal
+// fiscal, para aceitar tanto o procNFe quanto a NFe sem protocolo.
+type nfeProc struct {
+	NFe     nfeXML `xml:"NFe"`
+	ProtNFe struct {
+		ChNFe string `xml:"infProt>chNFe"`
+	} `xml:"protNFe"`
+}
+
+type nfeXML struct {
+	InfNFe struct {
+		ID  string `xml:"Id,attr"`
+		Ide struct {
+			NNF   string `xml:"nNF"`
+			DhEmi string `xml:"dhEmi"`
+		} `xml:"ide"`
+		Dest struct {
+			CPF string `xml:"CPF"`
+		} `xml:"dest"`
+		Emit struct {
+			CNPJ      string `xml:"CNPJ"`
+			XNome     string `xml:"xNome"`
+			XFant     string `xml:"xFant"`
+			IE        string `xml:"IE"`
+			EnderEmit struct {
+				XLgr    string `xml:"xLgr"`
+				Nro     string `xml:"nro"`
+				XCpl    string `xml:"xCpl"`
+				XBairro string `xml:"xBairro"`
+				XMun    string `xml:"xMun"`
+				UF      string `xml:"UF"`
+				CEP     string `xml:"CEP"`
+			} `xml:"enderEmit"`
+		} `xml:"emit"`
+		Det []struct {
+			Prod struct {
+				CProd    string `xml:"cProd"`
+				CEAN     string `xml:"cEAN"`
+				CEANTrib string `xml:"cEANTrib"`
+				XProd    string `xml:"xProd"`
+				NCM      string `xml:"NCM"`
+				UCom     string `xml:"uCom"`
+				QCom     string `xml:"qCom"`
+				VUnCom   string `xml:"vUnCom"`
+				VProd    string `xml:"vProd"`
+				VDesc    string `xml:"vDesc"`
+			} `xml:"prod"`
+		} `xml:"det"`
+		Total struct {
+			VProd    string `xml:"ICMSTot>vProd"`
+			VDesc    string `xml:"ICMSTot>vDesc"`
+			VFrete   string `xml:"ICMSTot>vFrete"`
+			VSeg     string `xml:"ICMSTot>vSeg"`
+			VOutro   string `xml:"ICMSTot>vOutro"`
+			VNF      string `xml:"ICMSTot>vNF"`
+			VTotTrib string `xml:"ICMSTot>vTotTrib"`
+		} `xml:"total"`
+		Pag struct {
+			DetPag []struct {
+				TPag string `xml:"tPag"`
+				VPag string `xml:"vPag"`
+			} `xml:"detPag"`
+			VTroco string `xml:"vTroco"`
+		} `xml:"pag"`
+	} `xml:"infNFe"`
+}
+
+// ParseXML lê o XML de distribuição (procNFe) ou a NFe assinada, no leiaute
+// 4.00, e produz a mesma nota que a consulta pelo portal.
+func ParseXML(r io.Reader) ([]models.ProductInvoice, models.Invoice, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, models.Invoice{}, err
+	}
+
+	var proc nfeProc
+	if strings.Contains(string(data), "<nfeProc") {
+		err = xml.Unmarshal(data, &proc)
+	} else {
+		err = xml.Unmarshal(data, &proc.NFe)
+	}
+	if err != nil {
+		return nil, models.Invoice{}, fmt.Errorf("%w: %v", ErrInvalidXML, err)
+	}
+	inf := proc.NFe.InfNFe
+
+	rawKey := proc.ProtNFe.ChNFe
+	if rawKey == "" {
+		rawKey = strings.TrimPrefix(inf.ID, "NFe")
+	}
+	key, err := ParseAccessKey(rawKey)
+	if err != nil {
+		return nil, models.Invoice{}, err
+	}
+
+	var invoice models.Invoice
+	invoice.InvoiceNumber = strings.TrimSpace(inf.Ide.NNF)
+	invoice.IssueDate = formatXMLDate(inf.Ide.DhEmi)
+	if t, err := time.Parse(time.RFC3339, strings.TrimSpace(inf.Ide.DhEmi)); err == nil {
+		invoice.IssuedAt = &t
+	}
+	applyConsumerCPF(&invoice, inf.Dest.CPF)
+	if inf.Emit.CNPJ != "" {
+		invoice.CNPJ = utils.FormatCNPJ(inf.Emit.CNPJ)
+	}
+
+	addr := inf.Emit.EnderEmit
+	street := []string{}
+	for _, p := range []string{addr.XLgr, addr.Nro, addr.XCpl} {
+		if p = strings.TrimSpace(p); p != "" {
+			street = append(street, p)
+		}
+	}
+	invoice.Merchant = models.Merchant{
+		CNPJ:              invoice.CNPJ,
+		Name:              strings.TrimSpace(inf.Emit.XNome),
+		TradeName:         strings.TrimSpace(inf.Emit.XFant),
+		StateRegistration: strings.TrimSpace(inf.Emit.IE),
+		Address: models.Address{
+			CEP:          addr.CEP,
+			Address:      strings.Join(street, ", "),
+			Neighborhood: addr.XBairro,
+			City:         addr.XMun,
+			State:        addr.UF,
+		},
+	}
+
+	var products []models.ProductInvoice
+	for i, det := range inf.Det {
+		p := det.Prod
+		if _, err := models.ParseMoneyDecimal(p.VProd); err != nil {
+			invoice.Missing = append(invoice.Missing, fmt.Sprintf("products[%d].value", i))
+		}
+		products = append(products, models.ProductInvoice{
+			Name:      strings.TrimSpace(p.XProd),
+			Code:      strings.TrimSpace(p.CProd),
+			GTIN:      xmlGTIN(p.CEAN, p.CEANTrib),
+			NCM:       strings.TrimSpace(p.NCM),
+			Quantity:  xmlQuantity(p.QCom),
+			Unit:      strings.TrimSpace(p.UCom),
+			UnitPrice: xmlMoney(p.VUnCom),
+			Value:     xmlMoney(p.VProd),
+			Discount:  xmlMoney(p.VDesc),
+		})
+	}
+
+	invoice.Totals = models.InvoiceTotals{
+		Gross:            xmlMoney(inf.Total.VProd),
+		Discount:         xmlMoney(inf.Total.VDesc),
+		Surcharges:       xmlMoney(inf.Total.VFrete) + xmlMoney(inf.Total.VSeg) + xmlMoney(inf.Total.VOutro),
+		Net:              xmlMoney(inf.Total.VNF),
+		ApproximateTaxes: xmlMoney(inf.Total.VTotTrib),
+	}
+	for _, pag := range inf.Pag.DetPag {
+		invoice.Payments = append(invoice.Payments, models.Payment{
+			Method:      PaymentMethodFromCode(pag.TPag),
+			Description: paymentDescriptions[strings.TrimSpace(pag.TPag)],
+			Amount:      xmlMoney(pag.VPag),
+		})
+	}
+	invoice.Change = xmlMoney(inf.Pag.VTroco)
+
+	if err := checkParsed(key.UF, "xml", &invoice, products); err != nil {
+		return nil, models.Invoice{}, err
+	}
+	return finish(products, invoice, key)
+}
+
+// formatXMLDate converte o dhEmi (ISO 8601 com fuso) para o formato exibido nos
+// portais, mantendo o horário local do emitente.
+func formatXMLDate(s string) string {
+	t, err := time.Parse(time.RFC3339, strings.TrimSpace(s))
+	if err != nil {
+		return strings.TrimSpace(s)
+	}
+	return t.Format("02/01/2006 15:04:05")
+}
+
+func xmlMoney(s string) models.Money {
+	if strings.TrimSpace(s) == "" {
+		return 0
+	}
+	v, _ := models.ParseMoneyDecimal(s)
+	return v
+}
+
+func xmlQuantity(s string) models.Quantity {
+	if strings.TrimSpace(s) == "" {
+		return 0
+	}
+	v, _ := models.ParseQuantityDecimal(s)
+	return v
+}
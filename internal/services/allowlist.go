@@ -0,0 +1,132 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"syscall"
+
+	"github.com/joaogustavosp/loyalty-api/internal/nfce"
+)
+
+var (
+	ErrHostNotAllowed = errors.New("host não permitido para consulta de NFC-e")
+	ErrBlockedAddress = errors.New("endereço de rede bloqueado")
+)
+
+// blockedPrefixes são as faixas reservadas que os métodos de netip.Addr não
+// cobrem. O NAT64 embute um IPv4 qualquer, inclusive interno, no endereço IPv6.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),      // "esta rede" (RFC 791)
+	netip.MustParsePrefix("100.64.0.0/10"),  // NAT de operadora (RFC 6598)
+	netip.MustParsePrefix("192.0.0.0/24"),   // atribuições do IETF (RFC 6890)
+	netip.MustParsePrefix("198.18.0.0/15"),  // testes de desempenho (RFC 2544)
+	netip.MustParsePrefix("240.0.0.0/4"),    // reservada, inclui o broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),   // NAT64 (RFC 6052)
+	netip.MustParsePrefix("64:ff9b:1::/48"), // NAT64 de uso local (RFC 8215)
+}
+
+// HostAllowlist guarda, por UF, os hosts oficiais de consulta de NFC-e que o
+// servidor pode acessar.
+type HostAllowlist struct {
+	hosts map[string]map[string]bool
+}
+
+func NewHostAllowlist(hosts map[string][]string) *HostAllowlist {
+	a := &HostAllowlist{hosts: map[string]map[string]bool{}}
+	for uf, list := range hosts {
+		for _, host := range list {
+			a.Add(uf, host)
+		}
+	}
+	return a
+}
+
+// DefaultHostAllowlist contém os hosts dos portais com parser registrado.
+func DefaultHostAllowlist() *HostAllowlist {
+	return NewHostAllowlist(nfce.PortalHosts())
+}
+
+func (a *HostAllowlist) Add(uf, host string) {
+	uf = strings.ToUpper(strings.TrimSpace(uf))
+	host = strings.ToLower(strings.TrimSpace(host))
+	if a.hosts[uf] == nil {
+		a.hosts[uf] = map[string]bool{}
+	}
+	a.hosts[uf][host] = true
+}
+
+// AddFromString acrescenta hosts no formato "UF:host,UF:host", usado na
+// variável de ambiente SEFAZ_ALLOWED_HOSTS.
+func (a *HostAllowlist) AddFromString(s string) error {
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		uf, host, ok := strings.Cut(entry, ":")
+		if !ok || len(strings.TrimSpace(uf)) != 2 || strings.TrimSpace(host) == "" {
+			return fmt.Errorf("entrada inválida na lista de hosts: %q", entry)
+		}
+		a.Add(uf, host)
+	}
+	return nil
+}
+
+// Allowed indica se o host é um portal de consulta da UF informada.
+func (a *HostAllowlist) Allowed(host, uf string) bool {
+	return a.hosts[strings.ToUpper(uf)][strings.ToLower(host)]
+}
+
+// AllowedAnyUF indica se o host é portal de consulta de alguma UF. É usado
+// nos redirecionamentos, quando a UF da nota já foi conferida.
+func (a *HostAllowlist) AllowedAnyUF(host string) bool {
+	host = strings.ToLower(host)
+	for _, hosts := range a.hosts {
+		if hosts[host] {
+			return true
+		}
+	}
+	return false
+}
+
+// guardDial é usado como Control do net.Dialer: roda depois da resolução de
+// DNS, para cada IP que será de fato conectado, e recusa endereços internos.
+// Verificar aqui, e não antes da requisição, evita o DNS rebinding.
+func guardDial(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if isBlockedIP(ip) {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, ip)
+	}
+	return nil
+}
+
+func isBlockedIP(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() ||
+		ip.IsUnspecified() ||
+		inBlockedPrefix(ip)
+}
+
+func inBlockedPrefix(ip netip.Addr) bool {
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
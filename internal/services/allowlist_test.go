@@ -0,0 +1,299 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestIsBlockedIP(t *testing.T) {
+	tests := []struct {
+		ip      string
+		blocked bool
+	}{
+		{"127.0.0.1", true},
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"192.168.0.10", true},
+		{"169.254.169.254", true},
+		{"100.64.0.1", true},
+		{"0.0.0.0", true},
+		{"0.1.2.3", true},
+		{"192.0.0.8", true},
+		{"198.18.0.1", true},
+		{"198.19.255.255", true},
+		{"240.0.0.1", true},
+		{"255.255.255.255", true},
+		{"224.0.0.1", true},
+		{"::", true},
+		{"::1", true},
+		{"fe80::1", true},
+		{"fc00::1", true},
+		{"ff02::1", true},
+		{"::ffff:127.0.0.1", true},
+		{"::ffff:10.0.0.1", true},
+		{"64:ff9b::a9fe:a9fe", true},
+		{"64:ff9b::7f00:1", true},
+		{"64:ff9b:1::a00:1", true},
+		{"8.8.8.8", false},
+		{"200.198.0.10", false},
+		{"198.20.0.1", false},
+		{"192.0.1.1", false},
+		{"100.128.0.1", false},
+		{"::ffff:8.8.8.8", false},
+		{"2001:4860:4860::8888", false},
+		{"64:ff9c::1", false},
+	}
+	for _, tt := range tests {
+		if got := isBlockedIP(netip.MustParseAddr(tt.ip)); got != tt.blocked {
+			t.Errorf("isBlockedIP(%s) = %v, want %v", tt.ip, got, tt.blocked)
+		}
+	}
+}
+
+func TestGuardDial(t *testing.T) {
+	tests := []struct {
+		address string
+		wantErr error
+	}{
+		{"127.0.0.1:443", ErrBlockedAddress},
+		{"[::1]:443", ErrBlockedAddress},
+		{"169.254.169.254:80", ErrBlockedAddress},
+		{"[64:ff9b::a9fe:a9fe]:80", ErrBlockedAddress},
+		{"198.18.0.1:443", ErrBlockedAddress},
+		{"200.198.0.10:443", nil},
+		{"[2001:4860:4860::8888]:443", nil},
+	}
+	for _, tt := range tests {
+		err := guardDial("tcp", tt.address, nil)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("guardDial(%s) = %v, want %v", tt.address, err, tt.wantErr)
+		}
+	}
+
+	if err := guardDial("tcp", "sem-porta", nil); err == nil {
+		t.Error("guardDial sem porta deveria falhar")
+	}
+}
+
+// O cliente usado contra os portais não conecta em endereços internos, mesmo
+// que o host tenha passado pela lista de permitidos.
+func TestSafeClientRefusesLoopback(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("o servidor interno não deveria ser alcançado")
+	}))
+	defer srv.Close()
+
+	fetcher := NewHTTPFetcher(FetcherConfig{MaxRetries: 0})
+	_, err := fetcher.Fetch(context.Background(), srv.URL)
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Fatalf("err = %v, want ErrBlockedAddress", err)
+	}
+}
+
+func TestHostAllowlistAllowed(t *testing.T) {
+	a := NewHostAllowlist(map[string][]string{"SP": {"www.nfce.fazenda.sp.gov.br"}, "rj": {" Consultadfe.Fazenda.RJ.gov.br "}})
+	tests := []struct {
+		host, uf string
+		want     bool
+	}{
+		{"www.nfce.fazenda.sp.gov.br", "SP", true},
+		{"WWW.NFCE.FAZENDA.SP.GOV.BR", "sp", true},
+		{"consultadfe.fazenda.rj.gov.br", "RJ", true},
+		{"www.nfce.fazenda.sp.gov.br", "RJ", false},
+		{"nfce.fazenda.sp.gov.br", "SP", false},
+		{"www.nfce.fazenda.sp.gov.br.evil.example", "SP", false},
+		{"evil.example", "SP", false},
+		{"", "SP", false},
+	}
+	for _, tt := range tests {
+		if got := a.Allowed(tt.host, tt.uf); got != tt.want {
+			t.Errorf("Allowed(%q, %q) = %v, want %v", tt.host, tt.uf, got, tt.want)
+		}
+	}
+	if !a.AllowedAnyUF("Consultadfe.fazenda.rj.gov.br") || a.AllowedAnyUF("evil.example") {
+		t.Error("AllowedAnyUF não confere os hosts de todas as UFs")
+	}
+}
+
+func TestHostAllowlistAddFromString(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    map[string][]string
+		wantErr bool
+	}{
+		{name: "vazia", in: ""},
+		{name: "só espaços e vírgulas", in: " , ,"},
+		{
+			name: "espaços, entradas vazias e maiúsculas",
+			in:   " sp:Homolog.Fazenda.SP.gov.br , ,RJ: consulta.rj.gov.br,",
+			want: map[string][]string{"SP": {"homolog.fazenda.sp.gov.br"}, "RJ": {"consulta.rj.gov.br"}},
+		},
+		{name: "sem UF", in: "consulta.rj.gov.br", wantErr: true},
+		{name: "UF vazia", in: ":consulta.rj.gov.br", wantErr: true},
+		{name: "UF com três letras", in: "RJX:consulta.rj.gov.br", wantErr: true},
+		{name: "host vazio", in: "RJ: ", wantErr: true},
+		{name: "erro depois de entrada válida", in: "RJ:consulta.rj.gov.br,SP", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewHostAllowlist(nil)
+			err := a.AddFromString(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("AddFromString(%q) err = nil, want erro", tt.in)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("AddFromString(%q) err = %v", tt.in, err)
+			}
+			want := NewHostAllowlist(tt.want)
+			if !reflect.DeepEqual(a.hosts, want.hosts) {
+				t.Errorf("AddFromString(%q) = %v, want %v", tt.in, a.hosts, want.hosts)
+			}
+		})
+	}
+}
+
+func TestCheckRedirect(t *testing.T) {
+	allowlist := DefaultHostAllowlist()
+	request := func(rawURL string) *http.Request {
+		req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return req
+	}
+	via := []*http.Request{request("https://www.nfce.fazenda.sp.gov.br/NFCeConsultaPublica/Paginas/ConsultaQRCode.aspx")}
+
+	tests := []struct {
+		name      string
+		allowlist *HostAllowlist
+		target    string
+		via       int
+		wantErr   error
+		// tooMany é o erro do limite de redirecionamentos, sem sentinela
+		tooMany bool
+	}{
+		{name: "outro portal oficial", allowlist: allowlist, target: "https://portalsped.fazenda.mg.gov.br/portalnfce/sistema/qrcode.xhtml", via: 1},
+		{name: "host fora da lista", allowlist: allowlist, target: "https://evil.example/", via: 1, wantErr: ErrHostNotAllowed},
+		{name: "portal oficial por HTTP", allowlist: allowlist, target: "http://www.nfce.fazenda.sp.gov.br/", via: 1, wantErr: ErrHostNotAllowed},
+		{name: "IP interno", allowlist: allowlist, target: "https://169.254.169.254/latest/meta-data", via: 1, wantErr: ErrHostNotAllowed},
+		{name: "redirecionamentos demais", allowlist: allowlist, target: "https://www.nfce.fazenda.sp.gov.br/", via: 5, tooMany: true},
+		{name: "sem lista, qualquer host HTTPS", target: "https://evil.example/", via: 1},
+		{name: "sem lista, HTTP recusado", target: "http://evil.example/", via: 1, wantErr: ErrHostNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain := make([]*http.Request, tt.via)
+			for i := range chain {
+				chain[i] = via[0]
+			}
+			err := checkRedirect(tt.allowlist)(request(tt.target), chain)
+			switch {
+			case tt.tooMany:
+				if err == nil {
+					t.Fatal("checkRedirect err = nil, want erro")
+				}
+			case tt.wantErr == nil && err != nil, tt.wantErr != nil && !errors.Is(err, tt.wantErr):
+				t.Fatalf("checkRedirect err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSafeClientRefusesRedirect(t *testing.T) {
+	targets := []string{"https://evil.example/", "http://www.nfce.fazenda.sp.gov.br/"}
+	for _, target := range targets {
+		srv := httptest.NewServer(http.RedirectHandler(target, http.StatusFound))
+		// O cliente de teste alcança o loopback; a regra de redirecionamento é
+		// a mesma do cliente seguro
+		client := &http.Client{CheckRedirect: checkRedirect(DefaultHostAllowlist())}
+		resp, err := client.Get(srv.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		srv.Close()
+		if !errors.Is(err, ErrHostNotAllowed) {
+			t.Errorf("redirecionamento para %s: err = %v, want ErrHostNotAllowed", target, err)
+		}
+	}
+}
+
+func TestValidateURLAllowlist(t *testing.T) {
+	s := NewExtractService(nil, DefaultHostAllowlist(), nil)
+	query := "?p=" + testAccessKey + "|2|1|1|ABCDEF"
+	tests := []struct {
+		name    string
+		url     string
+		wantErr error
+	}{
+		{name: "portal da UF da chave", url: "https://www.nfce.fazenda.sp.gov.br/NFCeConsultaPublica/Paginas/ConsultaQRCode.aspx" + query},
+		{name: "host maiúsculo", url: "https://WWW.NFCE.FAZENDA.SP.GOV.BR/NFCeConsultaPublica/Paginas/ConsultaQRCode.aspx" + query},
+		{name: "portal de outra UF", url: "https://portalsped.fazenda.mg.gov.br/portalnfce/sistema/qrcode.xhtml" + query, wantErr: ErrHostNotAllowed},
+		{name: "host fora da lista", url: "https://evil.example/qrcode" + query, wantErr: ErrHostNotAllowed},
+		{name: "sufixo do portal", url: "https://www.nfce.fazenda.sp.gov.br.evil.example/qrcode" + query, wantErr: ErrHostNotAllowed},
+		{name: "IP interno", url: "https://127.0.0.1/qrcode" + query, wantErr: ErrHostNotAllowed},
+		{name: "HTTP fora dos portais oficiais", url: "http://evil.example/qrcode" + query, wantErr: ErrInvalidURL},
+		{name: "HTTP no portal de outra UF", url: "http://www.fazenda.pr.gov.br/nfce/qrcode" + query, wantErr: ErrInvalidURL},
+		{name: "outro esquema", url: "ftp://www.nfce.fazenda.sp.gov.br/qrcode" + query, wantErr: ErrInvalidURL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := s.ValidateURL(tt.url)
+			if tt.wantErr == nil && err != nil || tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("ValidateURL(%q) err = %v, want %v", tt.url, err, tt.wantErr)
+			}
+		})
+	}
+
+	// Hosts de SEFAZ_ALLOWED_HOSTS valem só para a UF informada
+	extra := DefaultHostAllowlist()
+	if err := extra.AddFromString("SP:consulta.nfce.sp.gov.br"); err != nil {
+		t.Fatal(err)
+	}
+	if !extra.Allowed("consulta.nfce.sp.gov.br", "SP") || extra.Allowed("consulta.nfce.sp.gov.br", "MG") {
+		t.Error("host configurado fora da UF informada")
+	}
+}
+
+// Os QR Codes do PR e da BA trazem o endereço do portal com http://
+func TestValidateURLHTTPPortals(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		host string
+	}{
+		{
+			name: "PR",
+			url:  "http://www.fazenda.pr.gov.br/nfce/qrcode?p=41240512345678000195650010000123451000123453|2|1|1|ABCDEF",
+			host: "www.fazenda.pr.gov.br",
+		},
+		{
+			name: "BA",
+			url:  "http://nfe.sefaz.ba.gov.br/servicos/nfce/qrcode.aspx?p=29240512345678000195650010000123451000123459|2|1|1|ABCDEF",
+			host: "nfe.sefaz.ba.gov.br",
+		},
+	}
+	for _, tt := range tests {
+		for _, allowlist := range []*HostAllowlist{DefaultHostAllowlist(), nil} {
+			s := NewExtractService(nil, allowlist, nil)
+			parsedURL, payload, err := s.ValidateURL(tt.url)
+			if err != nil {
+				t.Fatalf("%s: ValidateURL err = %v", tt.name, err)
+			}
+			if parsedURL.Scheme != "https" || parsedURL.Hostname() != tt.host {
+				t.Errorf("%s: URL de consulta = %s, want HTTPS em %s", tt.name, parsedURL, tt.host)
+			}
+			if payload.AccessKey.UF != tt.name {
+				t.Errorf("%s: UF da chave = %s", tt.name, payload.AccessKey.UF)
+			}
+		}
+	}
+}
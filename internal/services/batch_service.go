@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/joaogustavosp/loyalty-api/internal/models"
+	"github.com/joaogustavosp/loyalty-api/internal/nfce"
+)
+
+// MaxBatchSize limita a quantidade de notas de um lote.
+const MaxBatchSize = 50
+
+var ErrInvalidBatchSize = fmt.Errorf("o lote deve ter entre 1 e %d notas", MaxBatchSize)
+
+// BatchResult é o resultado da extração de um item do lote. Code e Error só
+// são preenchidos quando a extração do item falha.
+type BatchResult struct {
+	Input    string                  `json:"input"`
+	Invoice  *models.Invoice         `json:"invoice,omitempty"`
+	Products []models.ProductInvoice `json:"products,omitempty"`
+	Code     ErrorCode               `json:"code,omitempty"`
+	Error    string                  `json:"error,omitempty"`
+}
+
+// BatchService extrai várias notas de uma vez, limitando quantas consultas à
+// SEFAZ ficam em andamento ao mesmo tempo.
+type BatchService struct {
+	extractService *ExtractService
+	concurrency    int
+}
+
+func NewBatchService(extractService *ExtractService, concurrency int) *BatchService {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &BatchService{extractService, concurrency}
+}
+
+// Extract processa cada item, uma URL de consulta ou uma chave de acesso, e
+// devolve os resultados na ordem da entrada. A falha de um item não
+// interrompe os demais. Lotes vazios ou com mais de MaxBatchSize itens são
+// recusados com ErrInvalidBatchSize.
+func (s *BatchService) Extract(ctx context.Context, inputs []string) ([]BatchResult, error) {
+	if len(inputs) == 0 || len(inputs) > MaxBatchSize {
+		return nil, ErrInvalidBatchSize
+	}
+
+	results := make([]BatchResult, len(inputs))
+	sem := make(chan struct{}, s.concurrency)
+	var wg sync.WaitGroup
+
+	for i, input := range inputs {
+		wg.Add(1)
+		go func(i int, input string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = s.extractOne(ctx, input)
+		}(i, input)
+	}
+	wg.Wait()
+	return results, nil
+}
+
+func (s *BatchService) extractOne(ctx context.Context, input string) BatchResult {
+	result := BatchResult{Input: input}
+
+	products, invoice, err := s.extract(ctx, strings.TrimSpace(input))
+	if err != nil {
+		extractErr := ClassifyError(err)
+		result.Code = extractErr.Code
+		result.Error = extractErr.Error()
+		return result
+	}
+	result.Invoice = &invoice
+	result.Products = products
+	return result
+}
+
+func (s *BatchService) extract(ctx context.Context, input string) ([]models.ProductInvoice, models.Invoice, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, models.Invoice{}, err
+	}
+	if strings.Contains(input, "://") {
+		return s.extractService.ExtractData(ctx, input)
+	}
+
+	// Sem URL, consultar a chave de acesso no portal da sua UF
+	accessKey, err := nfce.ParseAccessKey(input)
+	if err != nil {
+		return nil, models.Invoice{}, err
+	}
+	rawURL, err := nfce.QueryURL(accessKey)
+	if err != nil {
+		return nil, models.Invoice{}, err
+	}
+	return s.extractService.ExtractData(ctx, rawURL)
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowFetcher responde com a página do corpus ou com 404 para as URLs que
+// contêm notFound, e registra quantas consultas ficaram em andamento juntas.
+type slowFetcher struct {
+	page     []byte
+	notFound string
+	inFlight atomic.Int32
+	maxSeen  atomic.Int32
+}
+
+func (f *slowFetcher) Fetch(ctx context.Context, rawURL string) ([]byte, error) {
+	n := f.inFlight.Add(1)
+	defer f.inFlight.Add(-1)
+	for {
+		seen := f.maxSeen.Load()
+		if n <= seen || f.maxSeen.CompareAndSwap(seen, n) {
+			break
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	if f.notFound != "" && strings.Contains(rawURL, f.notFound) {
+		return nil, &HTTPStatusError{StatusCode: http.StatusNotFound, Status: "404 Not Found"}
+	}
+	return f.page, nil
+}
+
+func TestBatchExtract(t *testing.T) {
+	// Nota de outro número da mesma loja, ausente na SEFAZ
+	const missingKey = "35230512345678000195650010000123461000123460"
+	fetcher := &slowFetcher{page: fixturePage(t), notFound: missingKey}
+	s := NewBatchService(NewExtractService(fetcher, nil, nil), 2)
+
+	inputs := []string{
+		testQRCodeURL,
+		"chave inválida",
+		" " + testAccessKey + " ",
+		missingKey,
+		"https://www.nfce.fazenda.sp.gov.br/qrcode?p=" + missingKey + "|2|1|1|ABCDEF",
+		testQRCodeURL,
+	}
+	results, err := s.Extract(context.Background(), inputs)
+	if err != nil {
+		t.Fatalf("Extract err = %v", err)
+	}
+	if len(results) != len(inputs) {
+		t.Fatalf("%d resultados, want %d", len(results), len(inputs))
+	}
+
+	wantCodes := []ErrorCode{"", CodeInvalidURL, "", CodeInvoiceNotFound, CodeInvoiceNotFound, ""}
+	for i, result := range results {
+		if result.Input != inputs[i] {
+			t.Errorf("resultado %d é de %q, want %q", i, result.Input, inputs[i])
+		}
+		if result.Code != wantCodes[i] {
+			t.Errorf("resultado %d: code = %q (%s), want %q", i, result.Code, result.Error, wantCodes[i])
+		}
+		if wantCodes[i] == "" && (result.Invoice == nil || result.Invoice.AccessKey != testAccessKey || len(result.Products) == 0) {
+			t.Errorf("resultado %d sem a nota extraída: %+v", i, result)
+		}
+		if wantCodes[i] != "" && (result.Invoice != nil || result.Error == "") {
+			t.Errorf("resultado %d com falha incompleto: %+v", i, result)
+		}
+	}
+
+	if max := fetcher.maxSeen.Load(); max > 2 {
+		t.Errorf("%d consultas simultâneas, limite de 2", max)
+	}
+}
+
+func TestBatchExtractSize(t *testing.T) {
+	s := NewBatchService(NewExtractService(stubFetcher{}, nil, nil), 4)
+	tests := []struct {
+		name string
+		size int
+	}{
+		{"lote vazio", 0},
+		{"lote grande demais", MaxBatchSize + 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inputs := make([]string, tt.size)
+			for i := range inputs {
+				inputs[i] = testAccessKey
+			}
+			if _, err := s.Extract(context.Background(), inputs); !errors.Is(err, ErrInvalidBatchSize) {
+				t.Errorf("Extract err = %v, want ErrInvalidBatchSize", err)
+			}
+		})
+	}
+
+	t.Run("lote no limite", func(t *testing.T) {
+		inputs := make([]string, MaxBatchSize)
+		for i := range inputs {
+			inputs[i] = "chave inválida"
+		}
+		results, err := s.Extract(context.Background(), inputs)
+		if err != nil || len(results) != MaxBatchSize {
+			t.Fatalf("Extract = %d resultados, %v", len(results), err)
+		}
+	})
+}
+
+func TestBatchExtractCanceled(t *testing.T) {
+	fetcher := &countingFetcher{Fetcher: stubFetcher{}}
+	s := NewBatchService(NewExtractService(fetcher, nil, nil), 2)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results, err := s.Extract(ctx, []string{testQRCodeURL, testAccessKey})
+	if err != nil {
+		t.Fatalf("Extract err = %v", err)
+	}
+	for i, result := range results {
+		if result.Code == "" {
+			t.Errorf("resultado %d sem falha com o contexto cancelado", i)
+		}
+	}
+	if calls := fetcher.calls.Load(); calls != 0 {
+		t.Errorf("consultas = %d, want nenhuma", calls)
+	}
+}
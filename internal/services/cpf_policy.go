@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/joaogustavosp/loyalty-api/internal/models"
+	"github.com/joaogustavosp/loyalty-api/internal/nfce"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrConsumerCPFRequired = errors.New("a nota fiscal deve ter o CPF do consumidor")
+	ErrConsumerCPFMismatch = errors.New("o CPF da nota fiscal não é o do usuário")
+)
+
+// CPFPolicy define como o CPF do consumidor impresso na nota é conferido com o
+// CPF do usuário que resgata.
+type CPFPolicy string
+
+const (
+	// CPFRequireMatch exige que a nota tenha o CPF do próprio usuário
+	CPFRequireMatch CPFPolicy = "require_match"
+	// CPFAllowMissing aceita notas sem CPF, mas não com o CPF de outra pessoa
+	CPFAllowMissing CPFPolicy = "allow_missing"
+	// CPFRejectOthers só recusa o CPF de outro usuário cadastrado
+	CPFRejectOthers CPFPolicy = "reject_others"
+)
+
+// ParseCPFPolicy converte o valor da configuração, com CPFAllowMissing como
+// padrão.
+func ParseCPFPolicy(s string) (CPFPolicy, error) {
+	switch p := CPFPolicy(strings.ToLower(strings.TrimSpace(s))); p {
+	case "":
+		return CPFAllowMissing, nil
+	case CPFRequireMatch, CPFAllowMissing, CPFRejectOthers:
+		return p, nil
+	}
+	return "", fmt.Errorf("política de CPF desconhecida: %s", s)
+}
+
+// CPFVerifier confere o CPF do consumidor da nota contra o usuário
+// autenticado.
+type CPFVerifier struct {
+	userService *UserService
+	policy      CPFPolicy
+}
+
+func NewCPFVerifier(userService *UserService, policy CPFPolicy) *CPFVerifier {
+	return &CPFVerifier{userService, policy}
+}
+
+// Verify aplica a política à nota resgatada pelo usuário.
+func (v *CPFVerifier) Verify(ctx context.Context, userID string, invoice models.Invoice) error {
+	if invoice.ConsumerCPF == "" {
+		if v.policy == CPFRequireMatch {
+			return ErrConsumerCPFRequired
+		}
+		return nil
+	}
+
+	user, err := v.userService.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if nfce.ConsumerCPFMatches(invoice.ConsumerCPF, user.CPF) {
+		return nil
+	}
+	if v.policy != CPFRejectOthers {
+		return fmt.Errorf("%w: nota emitida para %s", ErrConsumerCPFMismatch, invoice.ConsumerCPFMasked)
+	}
+
+	// Um CPF mascarado não identifica o dono; um CPF completo só é recusado
+	// se pertencer a outro usuário
+	if nfce.IsMaskedCPF(invoice.ConsumerCPF) {
+		return nil
+	}
+	other, err := v.findUserByCPF(ctx, invoice.ConsumerCPF)
+	if err != nil {
+		return err
+	}
+	if other != nil && other.ID != user.ID {
+		return fmt.Errorf("%w: nota emitida para %s", ErrConsumerCPFMismatch, invoice.ConsumerCPFMasked)
+	}
+	return nil
+}
+
+// findUserByCPF procura o usuário pelo CPF com e sem formatação, já que o
+// cadastro guarda o CPF como foi digitado.
+func (v *CPFVerifier) findUserByCPF(ctx context.Context, cpf string) (*models.User, error) {
+	formatted := cpf[0:3] + "." + cpf[3:6] + "." + cpf[6:9] + "-" + cpf[9:11]
+	for _, candidate := range []string{cpf, formatted} {
+		user, err := v.userService.GetUserByCPF(ctx, candidate)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &user, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/joaogustavosp/loyalty-api/internal/models"
+	"github.com/joaogustavosp/loyalty-api/internal/nfce"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestParseCPFPolicy(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    CPFPolicy
+		wantErr bool
+	}{
+		{in: "", want: CPFAllowMissing},
+		{in: "require_match", want: CPFRequireMatch},
+		{in: " ALLOW_MISSING ", want: CPFAllowMissing},
+		{in: "reject_others", want: CPFRejectOthers},
+		{in: "off", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseCPFPolicy(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseCPFPolicy(%q) = %q, want erro", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseCPFPolicy(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+// cpfInvoice é a nota com o CPF do consumidor como o parser o grava.
+func cpfInvoice(cpf string) models.Invoice {
+	var invoice models.Invoice
+	if cpf != "" {
+		invoice.ConsumerCPF = cpf
+		invoice.ConsumerCPFMasked = nfce.MaskCPF(cpf)
+	}
+	return invoice
+}
+
+func TestCPFVerifierVerify(t *testing.T) {
+	const (
+		userCPF  = "52998224725"
+		otherCPF = "11144477735"
+	)
+	otherID, _ := primitive.ObjectIDFromHex("64b7f0c2a1b2c3d4e5f6071a")
+	otherUser := mtest.CreateCursorResponse(0, "db.users", mtest.FirstBatch, bson.D{
+		{Key: "_id", Value: otherID},
+		{Key: "cpf", Value: otherCPF},
+	})
+	noUser := mtest.CreateCursorResponse(0, "db.users", mtest.FirstBatch)
+
+	tests := []struct {
+		name      string
+		policy    CPFPolicy
+		cpf       string
+		responses []bson.D
+		want      error
+	}{
+		{name: "exige CPF, nota sem CPF", policy: CPFRequireMatch, want: ErrConsumerCPFRequired},
+		{name: "exige CPF, CPF do usuário", policy: CPFRequireMatch, cpf: userCPF, responses: []bson.D{userResponse(userCPF)}},
+		{name: "exige CPF, mascarado compatível", policy: CPFRequireMatch, cpf: "***982247**", responses: []bson.D{userResponse(userCPF)}},
+		{name: "exige CPF, mascarado de outra pessoa", policy: CPFRequireMatch, cpf: "***444777**", responses: []bson.D{userResponse(userCPF)}, want: ErrConsumerCPFMismatch},
+		{name: "exige CPF, CPF de outra pessoa", policy: CPFRequireMatch, cpf: otherCPF, responses: []bson.D{userResponse(userCPF)}, want: ErrConsumerCPFMismatch},
+		{name: "aceita sem CPF, nota sem CPF", policy: CPFAllowMissing},
+		{name: "aceita sem CPF, CPF do usuário", policy: CPFAllowMissing, cpf: userCPF, responses: []bson.D{userResponse(userCPF)}},
+		{name: "aceita sem CPF, CPF de outra pessoa", policy: CPFAllowMissing, cpf: otherCPF, responses: []bson.D{userResponse(userCPF)}, want: ErrConsumerCPFMismatch},
+		{name: "recusa outros, nota sem CPF", policy: CPFRejectOthers},
+		{name: "recusa outros, mascarado de outra pessoa", policy: CPFRejectOthers, cpf: "***444777**", responses: []bson.D{userResponse(userCPF)}},
+		{name: "recusa outros, CPF sem cadastro", policy: CPFRejectOthers, cpf: otherCPF, responses: []bson.D{userResponse(userCPF), noUser, noUser}},
+		{name: "recusa outros, CPF formatado de outro usuário", policy: CPFRejectOthers, cpf: otherCPF, responses: []bson.D{userResponse(userCPF), noUser, otherUser}, want: ErrConsumerCPFMismatch},
+		{name: "recusa outros, CPF de outro usuário", policy: CPFRejectOthers, cpf: otherCPF, responses: []bson.D{userResponse(userCPF), otherUser}, want: ErrConsumerCPFMismatch},
+	}
+
+	mt := newMockDB(t)
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			verifier := NewCPFVerifier(NewUserService(mt.Coll), tt.policy)
+			mt.AddMockResponses(tt.responses...)
+
+			err := verifier.Verify(context.Background(), testUserID, cpfInvoice(tt.cpf))
+			if tt.want == nil && err != nil || tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("Verify err = %v, want %v", err, tt.want)
+			}
+			if sent := len(sentCommands(mt)); sent != len(tt.responses) {
+				t.Errorf("consultas = %d, want %d", sent, len(tt.responses))
+			}
+		})
+	}
+
+	mt.Run("mensagem não expõe o CPF completo", func(mt *mtest.T) {
+		verifier := NewCPFVerifier(NewUserService(mt.Coll), CPFAllowMissing)
+		mt.AddMockResponses(userResponse(userCPF))
+
+		err := verifier.Verify(context.Background(), testUserID, cpfInvoice(otherCPF))
+		if err == nil || !errors.Is(err, ErrConsumerCPFMismatch) {
+			t.Fatalf("Verify err = %v", err)
+		}
+		if msg := err.Error(); !strings.Contains(msg, "***.444.777-**") || strings.Contains(msg, otherCPF) {
+			t.Errorf("mensagem = %q, want só o CPF mascarado", msg)
+		}
+	})
+}
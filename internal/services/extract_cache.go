@@ -0,0 +1,268 @@
+package services
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/joaogustavosp/loyalty-api/internal/models"
+	"github.com/joaogustavosp/loyalty-api/internal/nfce"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CachedExtraction é o resultado de uma extração pela SEFAZ, bem-sucedida ou
+// não, guardado pela chave de acesso.
+type CachedExtraction struct {
+	AccessKey string                  `bson:"_id"`
+	Invoice   models.Invoice          `bson:"invoice"`
+	Products  []models.ProductInvoice `bson:"products"`
+	// ConsumerCPF preserva o CPF da nota, que o Invoice não grava, para a
+	// conferência do resgate a partir do cache. Só é gravado o CPF que o
+	// portal já exibe mascarado; notas com o CPF completo não vão para o cache
+	ConsumerCPF  string    `bson:"consumer_cpf,omitempty"`
+	ErrorCode    ErrorCode `bson:"error_code,omitempty"`
+	ErrorMessage string    `bson:"error_message,omitempty"`
+	// ErrorCause e ErrorStatus identificam o erro original da falha, para que
+	// ela continue respondendo a errors.Is e errors.As depois de lida do cache
+	ErrorCause  string `bson:"error_cause,omitempty"`
+	ErrorStatus int    `bson:"error_status,omitempty"`
+	// ExpiresAt só é preenchido nas falhas: uma NFC-e emitida não muda, então
+	// os sucessos não expiram
+	ExpiresAt *time.Time `bson:"expires_at,omitempty"`
+}
+
+// cachedCauses são os erros sentinela das falhas que podem ir para o cache,
+// gravados pelo nome.
+var cachedCauses = []struct {
+	name string
+	err  error
+}{
+	{"contingency_pending", ErrContingencyPending},
+	{"invoice_not_found", nfce.ErrInvoiceNotFound},
+	{"layout_changed", nfce.ErrLayoutChanged},
+	{"totals_mismatch", nfce.ErrTotalsMismatch},
+	{"body_too_large", ErrBodyTooLarge},
+	{"deadline_exceeded", context.DeadlineExceeded},
+}
+
+// cachedError é a falha lida do cache: a mensagem original, envolvendo o
+// erro sentinela ou o HTTPStatusError que a causou.
+type cachedError struct {
+	message string
+	cause   error
+}
+
+func (e *cachedError) Error() string {
+	return e.message
+}
+
+func (e *cachedError) Unwrap() error {
+	return e.cause
+}
+
+// Err reconstrói a falha guardada, ou nil para um sucesso.
+func (e CachedExtraction) Err() error {
+	if e.ErrorCode == "" {
+		return nil
+	}
+	cause := &cachedError{message: e.ErrorMessage}
+	if e.ErrorStatus != 0 {
+		cause.cause = &HTTPStatusError{
+			StatusCode: e.ErrorStatus,
+			Status:     fmt.Sprintf("%d %s", e.ErrorStatus, http.StatusText(e.ErrorStatus)),
+		}
+	}
+	for _, c := range cachedCauses {
+		if c.name == e.ErrorCause {
+			cause.cause = c.err
+		}
+	}
+	return &ExtractError{Code: e.ErrorCode, Err: cause}
+}
+
+func (e CachedExtraction) expired(now time.Time) bool {
+	return e.ExpiresAt != nil && !now.Before(*e.ExpiresAt)
+}
+
+// ExtractionCache guarda os resultados das extrações pela chave de acesso.
+// Set recebe a falha da extração (ou nil) e define a expiração da entrada.
+type ExtractionCache interface {
+	Get(ctx context.Context, accessKey string) (CachedExtraction, bool, error)
+	Set(ctx context.Context, accessKey string, invoice models.Invoice, products []models.ProductInvoice, err error) error
+}
+
+// cacheableFailure indica se uma falha pode ser guardada. Falhas de validação
+// não chegam à SEFAZ e falhas não identificadas ou cancelamentos do próprio
+// cliente não dizem nada sobre a nota.
+func cacheableFailure(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	switch ClassifyError(err).Code {
+	case CodeInvoiceNotFound, CodeContingencyPending, CodeSefazUnavailable, CodeLayoutChanged:
+		return true
+	}
+	return false
+}
+
+// cacheableInvoice recusa as notas com o CPF completo do consumidor, que não
+// pode ser gravado.
+func cacheableInvoice(invoice models.Invoice) bool {
+	return invoice.ConsumerCPF == "" || nfce.IsMaskedCPF(invoice.ConsumerCPF)
+}
+
+func newCachedExtraction(accessKey string, invoice models.Invoice, products []models.ProductInvoice, err error, failureTTL time.Duration) CachedExtraction {
+	entry := CachedExtraction{AccessKey: accessKey}
+	if err == nil {
+		entry.Invoice = invoice
+		entry.ConsumerCPF = invoice.ConsumerCPF
+		entry.Products = append([]models.ProductInvoice(nil), products...)
+		return entry
+	}
+	extractErr := ClassifyError(err)
+	expiresAt := time.Now().Add(failureTTL)
+	entry.ErrorCode = extractErr.Code
+	entry.ErrorMessage = extractErr.Error()
+	entry.ExpiresAt = &expiresAt
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		entry.ErrorStatus = statusErr.StatusCode
+	}
+	for _, c := range cachedCauses {
+		if errors.Is(err, c.err) {
+			entry.ErrorCause = c.name
+			break
+		}
+	}
+	return entry
+}
+
+// LRUCache é o cache em memória, limitado ao número de entradas informado.
+type LRUCache struct {
+	mu         sync.Mutex
+	capacity   int
+	failureTTL time.Duration
+	order      *list.List
+	entries    map[string]*list.Element
+}
+
+func NewLRUCache(capacity int, failureTTL time.Duration) *LRUCache {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &LRUCache{
+		capacity:   capacity,
+		failureTTL: failureTTL,
+		order:      list.New(),
+		entries:    map[string]*list.Element{},
+	}
+}
+
+func (c *LRUCache) Get(ctx context.Context, accessKey string) (CachedExtraction, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[accessKey]
+	if !ok {
+		return CachedExtraction{}, false, nil
+	}
+	entry := el.Value.(CachedExtraction)
+	if entry.expired(time.Now()) {
+		c.order.Remove(el)
+		delete(c.entries, accessKey)
+		return CachedExtraction{}, false, nil
+	}
+	c.order.MoveToFront(el)
+	entry.Products = append([]models.ProductInvoice(nil), entry.Products...)
+	return entry, true, nil
+}
+
+func (c *LRUCache) Set(ctx context.Context, accessKey string, invoice models.Invoice, products []models.ProductInvoice, err error) error {
+	if err != nil && !cacheableFailure(err) {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err == nil && !cacheableInvoice(invoice) {
+		// Uma falha guardada antes para a mesma chave não vale mais
+		if el, ok := c.entries[accessKey]; ok {
+			c.order.Remove(el)
+			delete(c.entries, accessKey)
+		}
+		return nil
+	}
+	entry := newCachedExtraction(accessKey, invoice, products, err, c.failureTTL)
+
+	if el, ok := c.entries[accessKey]; ok {
+		el.Value = entry
+		c.order.MoveToFront(el)
+		return nil
+	}
+	c.entries[accessKey] = c.order.PushFront(entry)
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(CachedExtraction).AccessKey)
+	}
+	return nil
+}
+
+// MongoCache guarda as extrações numa coleção, compartilhada entre as
+// instâncias da API e preservada entre reinícios.
+type MongoCache struct {
+	collection *mongo.Collection
+	failureTTL time.Duration
+}
+
+func NewMongoCache(collection *mongo.Collection, failureTTL time.Duration) *MongoCache {
+	return &MongoCache{collection, failureTTL}
+}
+
+// EnsureIndexes cria o índice TTL que remove as falhas expiradas. Documentos
+// sem expires_at, os sucessos, nunca são removidos.
+func (c *MongoCache) EnsureIndexes(ctx context.Context) error {
+	_, err := c.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+func (c *MongoCache) Get(ctx context.Context, accessKey string) (CachedExtraction, bool, error) {
+	var entry CachedExtraction
+	err := c.collection.FindOne(ctx, bson.M{"_id": accessKey}).Decode(&entry)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return CachedExtraction{}, false, nil
+	}
+	if err != nil {
+		return CachedExtraction{}, false, err
+	}
+	// O índice TTL roda a cada minuto, então a expiração é conferida aqui
+	if entry.expired(time.Now()) {
+		return CachedExtraction{}, false, nil
+	}
+	entry.Invoice.ConsumerCPF = entry.ConsumerCPF
+	return entry, true, nil
+}
+
+func (c *MongoCache) Set(ctx context.Context, accessKey string, invoice models.Invoice, products []models.ProductInvoice, err error) error {
+	if err != nil && !cacheableFailure(err) {
+		return nil
+	}
+	if err == nil && !cacheableInvoice(invoice) {
+		// Uma falha guardada antes para a mesma chave não vale mais
+		_, deleteErr := c.collection.DeleteOne(ctx, bson.M{"_id": accessKey})
+		return deleteErr
+	}
+	entry := newCachedExtraction(accessKey, invoice, products, err, c.failureTTL)
+	opts := options.Replace().SetUpsert(true)
+	_, replaceErr := c.collection.ReplaceOne(ctx, bson.M{"_id": accessKey}, entry, opts)
+	return replaceErr
+}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/joaogustavosp/loyalty-api/internal/models"
+	"github.com/joaogustavosp/loyalty-api/internal/nfce"
+)
+
+func cachedInvoice(key string) models.Invoice {
+	return models.Invoice{AccessKey: key, InvoiceNumber: key[len(key)-3:]}
+}
+
+func TestLRUCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	cache := NewLRUCache(2, time.Minute)
+	cache.Set(ctx, "key-a01", cachedInvoice("key-a01"), nil, nil)
+	cache.Set(ctx, "key-b02", cachedInvoice("key-b02"), nil, nil)
+
+	// Ler "a" o torna o mais recente, e "b" passa a ser o próximo a sair
+	if _, ok, _ := cache.Get(ctx, "key-a01"); !ok {
+		t.Fatal("key-a01 deveria estar no cache")
+	}
+	cache.Set(ctx, "key-c03", cachedInvoice("key-c03"), nil, nil)
+
+	for key, want := range map[string]bool{"key-a01": true, "key-b02": false, "key-c03": true} {
+		if _, ok, _ := cache.Get(ctx, key); ok != want {
+			t.Errorf("Get(%s) ok = %v, want %v", key, ok, want)
+		}
+	}
+}
+
+func TestLRUCacheUpdatesExistingEntry(t *testing.T) {
+	ctx := context.Background()
+	cache := NewLRUCache(2, time.Minute)
+	cache.Set(ctx, "key-a01", models.Invoice{}, nil, &HTTPStatusError{StatusCode: 503, Status: "503 Service Unavailable"})
+	cache.Set(ctx, "key-a01", cachedInvoice("key-a01"), []models.ProductInvoice{{Name: "CAFE"}}, nil)
+	cache.Set(ctx, "key-b02", cachedInvoice("key-b02"), nil, nil)
+
+	entry, ok, _ := cache.Get(ctx, "key-a01")
+	if !ok || entry.Err() != nil || len(entry.Products) != 1 {
+		t.Fatalf("Get(key-a01) = %+v, %v", entry, ok)
+	}
+	if cache.order.Len() != 2 {
+		t.Errorf("entradas = %d, want 2", cache.order.Len())
+	}
+}
+
+func TestLRUCacheFailureTTL(t *testing.T) {
+	ctx := context.Background()
+	notFound := fmt.Errorf("consulta: %w", nfce.ErrInvoiceNotFound)
+
+	expired := NewLRUCache(10, 0)
+	expired.Set(ctx, "key-a01", models.Invoice{}, nil, notFound)
+	if _, ok, _ := expired.Get(ctx, "key-a01"); ok {
+		t.Error("falha expirada não deveria ser devolvida")
+	}
+	if _, ok := expired.entries["key-a01"]; ok {
+		t.Error("falha expirada deveria ser removida")
+	}
+
+	// Sucessos não expiram, mesmo com o prazo das falhas zerado
+	expired.Set(ctx, "key-b02", cachedInvoice("key-b02"), nil, nil)
+	if _, ok, _ := expired.Get(ctx, "key-b02"); !ok {
+		t.Error("sucesso deveria continuar no cache")
+	}
+
+	live := NewLRUCache(10, time.Hour)
+	live.Set(ctx, "key-a01", models.Invoice{}, nil, notFound)
+	entry, ok, _ := live.Get(ctx, "key-a01")
+	if !ok || entry.ExpiresAt == nil {
+		t.Fatalf("falha dentro do prazo deveria ser devolvida: %+v", entry)
+	}
+}
+
+func TestLRUCacheSkipsUncacheableFailures(t *testing.T) {
+	ctx := context.Background()
+	for _, err := range []error{
+		fmt.Errorf("%w: esquema ftp", ErrInvalidURL),
+		context.Canceled,
+		errors.New("falha desconhecida"),
+	} {
+		cache := NewLRUCache(10, time.Hour)
+		cache.Set(ctx, "key-a01", models.Invoice{}, nil, err)
+		if _, ok, _ := cache.Get(ctx, "key-a01"); ok {
+			t.Errorf("falha %q não deveria ir para o cache", err)
+		}
+	}
+}
+
+func TestLRUCacheReturnsCopyOfProducts(t *testing.T) {
+	ctx := context.Background()
+	cache := NewLRUCache(10, time.Hour)
+	cache.Set(ctx, "key-a01", cachedInvoice("key-a01"), []models.ProductInvoice{{Name: "CAFE"}}, nil)
+
+	entry, _, _ := cache.Get(ctx, "key-a01")
+	entry.Products[0].Name = "ALTERADO"
+	again, _, _ := cache.Get(ctx, "key-a01")
+	if again.Products[0].Name != "CAFE" {
+		t.Errorf("produto no cache alterado para %q", again.Products[0].Name)
+	}
+}
+
+func TestCachedExtractionErrKeepsCause(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		code   ErrorCode
+		target error
+		status int
+	}{
+		{name: "nota não encontrada", err: fmt.Errorf("portal: %w", nfce.ErrInvoiceNotFound), code: CodeInvoiceNotFound, target: nfce.ErrInvoiceNotFound},
+		{name: "contingência", err: fmt.Errorf("%w: não encontrada", ErrContingencyPending), code: CodeContingencyPending, target: ErrContingencyPending},
+		{name: "layout", err: &nfce.LayoutChangedError{UF: "MG", Parser: "mg", Missing: []string{"products"}}, code: CodeLayoutChanged, target: nfce.ErrLayoutChanged},
+		{name: "totais", err: fmt.Errorf("%w: item 1", nfce.ErrTotalsMismatch), code: CodeLayoutChanged, target: nfce.ErrTotalsMismatch},
+		{name: "timeout", err: fmt.Errorf("consulta: %w", context.DeadlineExceeded), code: CodeSefazUnavailable, target: context.DeadlineExceeded},
+		{name: "SEFAZ fora do ar", err: &HTTPStatusError{StatusCode: 503, Status: "503 Service Unavailable"}, code: CodeSefazUnavailable, status: 503},
+		{name: "404 do portal", err: &HTTPStatusError{StatusCode: 404, Status: "404 Not Found"}, code: CodeInvoiceNotFound, status: 404},
+	}
+	ctx := context.Background()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := NewLRUCache(10, time.Hour)
+			cache.Set(ctx, "key-a01", models.Invoice{}, nil, tt.err)
+			entry, ok, _ := cache.Get(ctx, "key-a01")
+			if !ok {
+				t.Fatal("falha deveria estar no cache")
+			}
+
+			err := entry.Err()
+			var extractErr *ExtractError
+			if !errors.As(err, &extractErr) || extractErr.Code != tt.code {
+				t.Fatalf("Err() = %#v, want ExtractError %s", err, tt.code)
+			}
+			if ClassifyError(err).Code != tt.code {
+				t.Errorf("ClassifyError = %s, want %s", ClassifyError(err).Code, tt.code)
+			}
+			if err.Error() != tt.err.Error() {
+				t.Errorf("mensagem = %q, want %q", err.Error(), tt.err.Error())
+			}
+			if tt.target != nil && !errors.Is(err, tt.target) {
+				t.Errorf("errors.Is(%v, %v) = false", err, tt.target)
+			}
+			if tt.status != 0 {
+				var statusErr *HTTPStatusError
+				if !errors.As(err, &statusErr) || statusErr.StatusCode != tt.status {
+					t.Errorf("errors.As HTTPStatusError = %v, want status %d", statusErr, tt.status)
+				}
+			}
+		})
+	}
+}
+
+func TestCacheSkipsInvoicesWithFullConsumerCPF(t *testing.T) {
+	ctx := context.Background()
+	cache := NewLRUCache(10, time.Hour)
+
+	// Uma falha anterior da mesma chave não pode sobreviver ao sucesso
+	cache.Set(ctx, "key-a01", models.Invoice{}, nil, nfce.ErrInvoiceNotFound)
+	full := cachedInvoice("key-a01")
+	full.ConsumerCPF = "52998224725"
+	cache.Set(ctx, "key-a01", full, nil, nil)
+	if _, ok, _ := cache.Get(ctx, "key-a01"); ok {
+		t.Error("nota com CPF completo não deveria ir para o cache")
+	}
+
+	masked := cachedInvoice("key-b02")
+	masked.ConsumerCPF = "***982247**"
+	cache.Set(ctx, "key-b02", masked, nil, nil)
+	entry, ok, _ := cache.Get(ctx, "key-b02")
+	if !ok || entry.Invoice.ConsumerCPF != "***982247**" {
+		t.Errorf("nota com CPF mascarado = %+v, %v", entry.Invoice, ok)
+	}
+
+	cache.Set(ctx, "key-c03", cachedInvoice("key-c03"), nil, nil)
+	if _, ok, _ := cache.Get(ctx, "key-c03"); !ok {
+		t.Error("nota sem CPF deveria ir para o cache")
+	}
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/joaogustavosp/loyalty-api/internal/nfce"
+)
+
+// ErrorCode é o código estável de uma falha de extração, que o aplicativo usa
+// para escolher a mensagem exibida ao usuário.
+type ErrorCode string
+
+const (
+	CodeInvalidURL       ErrorCode = "INVALID_URL"
+	CodeInvalidDocument  ErrorCode = "INVALID_DOCUMENT"
+	CodeUnsupportedState ErrorCode = "UNSUPPORTED_STATE"
+	CodeInvoiceNotFound  ErrorCode = "INVOICE_NOT_FOUND"
+	// CodeContingencyPending é a nota em contingência ainda não transmitida à
+	// SEFAZ, que vale tentar de novo mais tarde
+	CodeContingencyPending ErrorCode = "CONTINGENCY_PENDING"
+	CodeSefazUnavailable   ErrorCode = "SEFAZ_UNAVAILABLE"
+	CodeLayoutChanged      ErrorCode = "LAYOUT_CHANGED"
+	CodeInvoiceTooOld      ErrorCode = "INVOICE_TOO_OLD"
+	CodeAlreadyClaimed     ErrorCode = "ALREADY_CLAIMED"
+	CodeCPFRequired        ErrorCode = "CPF_REQUIRED"
+	CodeCPFMismatch        ErrorCode = "CPF_MISMATCH"
+	CodeInternal           ErrorCode = "INTERNAL_ERROR"
+)
+
+var (
+	ErrInvalidURL         = errors.New("URL de consulta inválida")
+	ErrInvoiceTooOld      = errors.New("nota fiscal fora do prazo para resgate")
+	ErrContingencyPending = errors.New("nota fiscal emitida em contingência ainda não disponível na SEFAZ")
+)
+
+// ExtractError é uma falha de extração ou de resgate com o seu código.
+type ExtractError struct {
+	Code ErrorCode
+	Err  error
+}
+
+func (e *ExtractError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ExtractError) Unwrap() error {
+	return e.Err
+}
+
+// ClassifyError converte os erros de validação, acesso à SEFAZ, leitura da
+// página e resgate em um ExtractError. Erros não reconhecidos recebem
+// CodeInternal.
+func ClassifyError(err error) *ExtractError {
+	if err == nil {
+		return nil
+	}
+	var extractErr *ExtractError
+	if errors.As(err, &extractErr) {
+		return extractErr
+	}
+	return &ExtractError{Code: classify(err), Err: err}
+}
+
+func classify(err error) ErrorCode {
+	var (
+		unsupported *nfce.UnsupportedStateError
+		statusErr   *HTTPStatusError
+		netErr      net.Error
+	)
+	switch {
+	case errors.Is(err, ErrInvalidURL),
+		errors.Is(err, nfce.ErrInvalidAccessKey),
+		errors.Is(err, ErrHostNotAllowed),
+		errors.Is(err, ErrBlockedAddress):
+		return CodeInvalidURL
+	case errors.Is(err, nfce.ErrAccessKeyNotFound),
+		errors.Is(err, nfce.ErrInvalidXML),
+		errors.Is(err, nfce.ErrInvalidImage),
+		errors.Is(err, nfce.ErrQRCodeNotFound),
+		errors.Is(err, nfce.ErrIssueDateMismatch),
+		errors.Is(err, ErrInvoiceFromFuture),
+		errors.Is(err, ErrMissingAccessKey):
+		return CodeInvalidDocument
+	case errors.As(err, &unsupported):
+		return CodeUnsupportedState
+	case errors.Is(err, ErrContingencyPending):
+		return CodeContingencyPending
+	case errors.Is(err, nfce.ErrInvoiceNotFound):
+		return CodeInvoiceNotFound
+	case errors.As(err, &statusErr):
+		if statusErr.StatusCode == 404 {
+			return CodeInvoiceNotFound
+		}
+		return CodeSefazUnavailable
+	case errors.Is(err, nfce.ErrLayoutChanged),
+		errors.Is(err, nfce.ErrTotalsMismatch):
+		return CodeLayoutChanged
+	case errors.Is(err, ErrInvoiceTooOld):
+		return CodeInvoiceTooOld
+	case errors.Is(err, ErrInvoiceAlreadyClaimed):
+		return CodeAlreadyClaimed
+	case errors.Is(err, ErrConsumerCPFRequired):
+		return CodeCPFRequired
+	case errors.Is(err, ErrConsumerCPFMismatch):
+		return CodeCPFMismatch
+	case errors.Is(err, ErrBodyTooLarge),
+		errors.Is(err, context.DeadlineExceeded),
+		errors.As(err, &netErr):
+		return CodeSefazUnavailable
+	}
+	return CodeInternal
+}
+
+// Retryable indica se vale tentar a extração de novo mais tarde: apenas
+// quando a SEFAZ estava fora do ar ou a falha não foi identificada.
+func (e *ExtractError) Retryable() bool {
+	return e.Code == CodeSefazUnavailable || e.Code == CodeInternal
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/joaogustavosp/loyalty-api/internal/nfce"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorCode
+	}{
+		{"URL inválida", ErrInvalidURL, CodeInvalidURL},
+		{"chave inválida", nfce.ErrInvalidAccessKey, CodeInvalidURL},
+		{"host fora da lista", ErrHostNotAllowed, CodeInvalidURL},
+		{"endereço bloqueado", ErrBlockedAddress, CodeInvalidURL},
+		{"documento sem chave", nfce.ErrAccessKeyNotFound, CodeInvalidDocument},
+		{"XML inválido", nfce.ErrInvalidXML, CodeInvalidDocument},
+		{"imagem inválida", nfce.ErrInvalidImage, CodeInvalidDocument},
+		{"QR Code não encontrado", nfce.ErrQRCodeNotFound, CodeInvalidDocument},
+		{"data de outro mês", nfce.ErrIssueDateMismatch, CodeInvalidDocument},
+		{"data no futuro", ErrInvoiceFromFuture, CodeInvalidDocument},
+		{"nota sem chave", ErrMissingAccessKey, CodeInvalidDocument},
+		{"UF sem parser", &nfce.UnsupportedStateError{UF: "XX"}, CodeUnsupportedState},
+		{"contingência", ErrContingencyPending, CodeContingencyPending},
+		{"nota não encontrada", nfce.ErrInvoiceNotFound, CodeInvoiceNotFound},
+		{"HTTP 404", &HTTPStatusError{StatusCode: http.StatusNotFound}, CodeInvoiceNotFound},
+		{"HTTP 503", &HTTPStatusError{StatusCode: http.StatusServiceUnavailable}, CodeSefazUnavailable},
+		{"HTTP 403", &HTTPStatusError{StatusCode: http.StatusForbidden}, CodeSefazUnavailable},
+		{"layout mudou", nfce.ErrLayoutChanged, CodeLayoutChanged},
+		{"totais não conferem", nfce.ErrTotalsMismatch, CodeLayoutChanged},
+		{"fora do prazo", ErrInvoiceTooOld, CodeInvoiceTooOld},
+		{"já resgatada", ErrInvoiceAlreadyClaimed, CodeAlreadyClaimed},
+		{"CPF exigido", ErrConsumerCPFRequired, CodeCPFRequired},
+		{"CPF de outra pessoa", ErrConsumerCPFMismatch, CodeCPFMismatch},
+		{"resposta grande demais", ErrBodyTooLarge, CodeSefazUnavailable},
+		{"prazo esgotado", context.DeadlineExceeded, CodeSefazUnavailable},
+		{"falha de rede", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, CodeSefazUnavailable},
+		{"erro embrulhado", fmt.Errorf("consulta: %w", nfce.ErrInvoiceNotFound), CodeInvoiceNotFound},
+		{"já classificado", &ExtractError{Code: CodeCPFRequired, Err: errors.New("x")}, CodeCPFRequired},
+		{"erro desconhecido", errors.New("falha qualquer"), CodeInternal},
+		{"cancelado pelo cliente", context.Canceled, CodeInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ClassifyError(tt.err)
+			if got.Code != tt.want {
+				t.Errorf("ClassifyError(%v).Code = %s, want %s", tt.err, got.Code, tt.want)
+			}
+			if !errors.Is(got, tt.err) {
+				t.Errorf("ClassifyError(%v) não preserva o erro original", tt.err)
+			}
+		})
+	}
+
+	if ClassifyError(nil) != nil {
+		t.Error("ClassifyError(nil) != nil")
+	}
+}
@@ -1,86 +1,169 @@
 package services
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	"net/http"
-	"regexp"
+	"io"
+	"log"
+	"net/url"
 	"strings"
 
-	"github.com/PuerkitoBio/goquery"
 	"github.com/joaogustavosp/loyalty-api/internal/models"
+	"github.com/joaogustavosp/loyalty-api/internal/nfce"
 )
 
-type ExtractService struct{}
+type ExtractService struct {
+	fetcher   Fetcher
+	allowlist *HostAllowlist
+	cache     ExtractionCache
+}
 
-func NewExtractService() *ExtractService {
-	return &ExtractService{}
+// NewExtractService cria o serviço de extração. Com allowlist nil o host da
+// URL não é conferido, o que só deve ser usado em testes; com cache nil toda
+// extração consulta a SEFAZ.
+func NewExtractService(fetcher Fetcher, allowlist *HostAllowlist, cache ExtractionCache) *ExtractService {
+	return &ExtractService{fetcher, allowlist, cache}
 }
 
-func (s *ExtractService) ExtractData(url string) ([]models.ProductInvoice, models.Invoice, error) {
+// ValidateURL confere a URL de consulta sem acessá-la: HTTPS, QR Code com
+// chave válida emitido em produção, host oficial da UF da chave e parser
+// disponível para o portal. Alguns estados, como PR e BA, imprimem no QR Code
+// o endereço do portal com http://; nos hosts oficiais da UF a consulta é
+// feita em HTTPS.
+func (s *ExtractService) ValidateURL(rawURL string) (*url.URL, nfce.QRPayload, error) {
 	// Validar a URL
-	if !strings.HasPrefix(url, "https://") {
-		return nil, models.Invoice{}, fmt.Errorf("URL deve usar HTTPS")
+	if !strings.HasPrefix(rawURL, "https://") && !strings.HasPrefix(rawURL, "http://") {
+		return nil, nfce.QRPayload{}, fmt.Errorf("%w: deve usar HTTPS", ErrInvalidURL)
+	}
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, nfce.QRPayload{}, fmt.Errorf("%w: %v", ErrInvalidURL, err)
 	}
 
-	// Realizar a requisição HTTP
-	resp, err := http.Get(url)
+	// Validar o QR Code e a chave de acesso antes de qualquer requisição
+	payload, err := nfce.ParseQRPayload(rawURL)
 	if err != nil {
-		return nil, models.Invoice{}, err
+		return nil, nfce.QRPayload{}, err
+	}
+	if payload.Environment == nfce.EnvironmentHomologation {
+		return nil, nfce.QRPayload{}, fmt.Errorf("%w: nota emitida em ambiente de homologação", ErrInvalidURL)
 	}
-	defer resp.Body.Close()
+	accessKey := payload.AccessKey
 
-	// Verificar se a requisição foi bem-sucedida
-	if resp.StatusCode != 200 {
-		return nil, models.Invoice{}, fmt.Errorf("Erro ao acessar URL: %s", resp.Status)
+	if parsedURL.Scheme == "http" {
+		if !s.officialHost(parsedURL.Hostname(), accessKey.UF) {
+			return nil, nfce.QRPayload{}, fmt.Errorf("%w: deve usar HTTPS", ErrInvalidURL)
+		}
+		parsedURL.Scheme = "https"
 	}
 
-	// Parsear o HTML
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	// Aceitar apenas os portais oficiais da UF da nota
+	if s.allowlist != nil && !s.allowlist.Allowed(parsedURL.Hostname(), accessKey.UF) {
+		return nil, nfce.QRPayload{}, fmt.Errorf("%w: %s para UF %s", ErrHostNotAllowed, parsedURL.Hostname(), accessKey.UF)
+	}
+
+	// Verificar se há parser para o portal da UF
+	if _, err := nfce.ParserFor(parsedURL.Hostname(), accessKey); err != nil {
+		return nil, nfce.QRPayload{}, err
+	}
+	return parsedURL, payload, nil
+}
+
+// officialHost indica se o host é um portal de consulta da UF, pela lista de
+// permitidos ou, sem ela, pelos portais com parser registrado.
+func (s *ExtractService) officialHost(host, uf string) bool {
+	allowlist := s.allowlist
+	if allowlist == nil {
+		allowlist = DefaultHostAllowlist()
+	}
+	return allowlist.Allowed(host, uf)
+}
+
+func (s *ExtractService) ExtractData(ctx context.Context, rawURL string) ([]models.ProductInvoice, models.Invoice, error) {
+	return s.extract(ctx, rawURL, true)
+}
+
+// Refetch extrai a nota sem ler o cache, que pode guardar a falha que motivou
+// a nova tentativa, e grava o resultado como ExtractData. Usado nas novas
+// tentativas dos jobs e das notas pendentes.
+func (s *ExtractService) Refetch(ctx context.Context, rawURL string) ([]models.ProductInvoice, models.Invoice, error) {
+	return s.extract(ctx, rawURL, false)
+}
+
+func (s *ExtractService) extract(ctx context.Context, rawURL string, readCache bool) ([]models.ProductInvoice, models.Invoice, error) {
+	parsedURL, payload, err := s.ValidateURL(rawURL)
 	if err != nil {
 		return nil, models.Invoice{}, err
 	}
+	accessKey := payload.AccessKey
+
+	// Uma NFC-e emitida não muda: consultar o cache antes da SEFAZ
+	if s.cache != nil && readCache {
+		entry, ok, err := s.cache.Get(ctx, accessKey.Key)
+		if err != nil {
+			log.Printf("erro ao consultar cache de extração: %v", err)
+		} else if ok {
+			return entry.Products, entry.Invoice, entry.Err()
+		}
+	}
 
-	var productInvoices []models.ProductInvoice
-	var invoice models.Invoice
-
-	// Expressão regular para extrair apenas números, pontos e vírgulas
-	reNumber := regexp.MustCompile(`[0-9,.]+`)
-	// Expressão regular para extrair o código
-	reCode := regexp.MustCompile(`Código: (\d+)`)
-	// Expressão regular para extrair o CNPJ
-	reCNPJ := regexp.MustCompile(`CNPJ: (\d{2}\.\d{3}\.\d{3}\/\d{4}\-\d{2})`)
-
-	// Encontrar o elemento com id="collapse4" e extrair os dados da nota
-	collapse4 := doc.Find("#collapse4")
-	invoice.InvoiceNumber = strings.TrimSpace(collapse4.Find("table:nth-child(8) > tbody > tr > td:nth-child(3)").Text())
-	invoice.IssueDate = strings.TrimSpace(collapse4.Find("table:nth-child(8) > tbody > tr > td:nth-child(4)").Text())
-	cnpjText := doc.Find("td:contains('CNPJ')").Text()
-	cnpj := reCNPJ.FindStringSubmatch(cnpjText)
-	if len(cnpj) > 1 {
-		invoice.CNPJ = cnpj[1]
-	} else {
-		invoice.CNPJ = ""
-	}
-
-	// Selecionar e extrair os dados dos produtos
-	doc.Find("table.table-striped tbody tr").Each(func(i int, s *goquery.Selection) {
-		codeText := s.Find("td:nth-child(1)").Text()
-		code := reCode.FindStringSubmatch(codeText)
-		if len(code) > 1 {
-			codeText = code[1]
-		} else {
-			codeText = ""
+	products, invoice, err := s.fetchAndParse(ctx, parsedURL, payload)
+
+	if s.cache != nil {
+		if cacheErr := s.cache.Set(ctx, accessKey.Key, invoice, products, err); cacheErr != nil {
+			log.Printf("erro ao gravar cache de extração: %v", cacheErr)
 		}
+	}
+	return products, invoice, err
+}
 
-		ProductInvoice := models.ProductInvoice{
-			Name:     strings.TrimSpace(s.Find("td:nth-child(1) h7").Text()),
-			Code:     codeText,
-			Quantity: reNumber.FindString(s.Find("td:nth-child(2)").Text()),
-			Unit:     strings.TrimSpace(s.Find("td:nth-child(3)").Text()),
-			Value:    reNumber.FindString(s.Find("td:nth-child(4)").Text()),
+func (s *ExtractService) fetchAndParse(ctx context.Context, parsedURL *url.URL, payload nfce.QRPayload) ([]models.ProductInvoice, models.Invoice, error) {
+	// Baixar a página de consulta
+	body, err := s.fetcher.Fetch(ctx, parsedURL.String())
+	if err != nil {
+		return nil, models.Invoice{}, err
+	}
+
+	products, invoice, err := nfce.ParseHTML(bytes.NewReader(body), parsedURL.Hostname(), &payload.AccessKey)
+	if err != nil {
+		// A nota em contingência só aparece na SEFAZ depois de transmitida
+		if errors.Is(err, nfce.ErrInvoiceNotFound) && payload.Contingency() {
+			return nil, models.Invoice{}, fmt.Errorf("%w: %v", ErrContingencyPending, err)
 		}
-		productInvoices = append(productInvoices, ProductInvoice)
-	})
+		return nil, models.Invoice{}, err
+	}
+	invoice.Warnings = append(invoice.Warnings, payload.Check(invoice)...)
+	return products, invoice, nil
+}
 
-	return productInvoices, invoice, nil
+// FetchPage baixa a página de consulta de uma URL validada, sem passar pelo
+// cache nem extrair a nota. Usado para salvar páginas no corpus de testes.
+func (s *ExtractService) FetchPage(ctx context.Context, rawURL string) ([]byte, error) {
+	parsedURL, _, err := s.ValidateURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return s.fetcher.Fetch(ctx, parsedURL.String())
+}
+
+// ExtractFromFile extrai a nota de uma página de consulta salva ou do XML da
+// NF-e enviado pelo usuário, sem acessar a SEFAZ. O host da URL de consulta,
+// quando conhecido, ajuda a escolher o parser da página.
+func (s *ExtractService) ExtractFromFile(data []byte, host string) ([]models.ProductInvoice, models.Invoice, error) {
+	if nfce.IsXML(data) {
+		return nfce.ParseXML(bytes.NewReader(data))
+	}
+	return nfce.ParseHTML(bytes.NewReader(data), host, nil)
+}
+
+// ExtractFromImage decodifica o QR Code de uma foto do cupom e segue o mesmo
+// fluxo da extração pela URL de consulta.
+func (s *ExtractService) ExtractFromImage(ctx context.Context, r io.Reader) ([]models.ProductInvoice, models.Invoice, error) {
+	rawURL, err := nfce.DecodeQRCodeImage(r)
+	if err != nil {
+		return nil, models.Invoice{}, err
+	}
+	return s.ExtractData(ctx, rawURL)
 }
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+var ErrBodyTooLarge = errors.New("resposta do portal excede o tamanho máximo")
+
+// Fetcher baixa a página de consulta da nota no portal da SEFAZ. A interface
+// permite trocar o cliente HTTP, por exemplo por um httptest.Server nos testes.
+type Fetcher interface {
+	Fetch(ctx context.Context, rawURL string) ([]byte, error)
+}
+
+// HTTPStatusError é a resposta do portal com status diferente de 200.
+type HTTPStatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("Erro ao acessar URL: %s", e.Status)
+}
+
+type FetcherConfig struct {
+	// Timeout é o prazo de cada tentativa, limitado também pelo contexto da
+	// requisição que originou a extração
+	Timeout time.Duration
+	// MaxRetries é o número de novas tentativas após erro 5xx ou timeout
+	MaxRetries int
+	// Backoff é a espera antes da primeira nova tentativa, dobrada a cada vez
+	Backoff     time.Duration
+	MaxBodySize int64
+	UserAgent   string
+	// Allowlist limita os hosts aceitos em redirecionamentos
+	Allowlist *HostAllowlist
+	// Client, se informado, substitui o cliente HTTP padrão, inclusive as
+	// proteções de rede, como nos testes com httptest
+	Client *http.Client
+}
+
+func DefaultFetcherConfig() FetcherConfig {
+	return FetcherConfig{
+		Timeout:     15 * time.Second,
+		MaxRetries:  2,
+		Backoff:     500 * time.Millisecond,
+		MaxBodySize: 2 << 20,
+		UserAgent:   "loyalty-api/1.0 (+consulta NFC-e)",
+	}
+}
+
+type HTTPFetcher struct {
+	client *http.Client
+	config FetcherConfig
+}
+
+func NewHTTPFetcher(config FetcherConfig) *HTTPFetcher {
+	client := config.Client
+	if client == nil {
+		client = newSafeClient(config.Allowlist)
+	}
+	return &HTTPFetcher{client: client, config: config}
+}
+
+// newSafeClient monta o cliente usado contra os portais: sem proxy, com
+// conexão recusada para IPs internos e redirecionamentos só para HTTPS em
+// hosts da lista de permitidos.
+func newSafeClient(allowlist *HostAllowlist) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   guardDial,
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Transport:     transport,
+		CheckRedirect: checkRedirect(allowlist),
+	}
+}
+
+// checkRedirect aceita até cinco redirecionamentos, só para HTTPS e, com a
+// lista de permitidos, só para hosts de consulta de alguma UF.
+func checkRedirect(allowlist *HostAllowlist) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 5 {
+			return errors.New("redirecionamentos demais")
+		}
+		if req.URL.Scheme != "https" {
+			return fmt.Errorf("%w: redirecionamento para %s", ErrHostNotAllowed, req.URL.Scheme)
+		}
+		if allowlist != nil && !allowlist.AllowedAnyUF(req.URL.Hostname()) {
+			return fmt.Errorf("%w: redirecionamento para %s", ErrHostNotAllowed, req.URL.Hostname())
+		}
+		return nil
+	}
+}
+
+func (f *HTTPFetcher) Fetch(ctx context.Context, rawURL string) ([]byte, error) {
+	backoff := f.config.Backoff
+	for attempt := 0; ; attempt++ {
+		body, err := f.fetchOnce(ctx, rawURL)
+		if err == nil || attempt >= f.config.MaxRetries || !f.shouldRetry(ctx, err) {
+			return body, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (f *HTTPFetcher) fetchOnce(ctx context.Context, rawURL string) ([]byte, error) {
+	if f.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.config.Timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", f.config.UserAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &HTTPStatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	limit := f.config.MaxBodySize
+	if limit <= 0 {
+		return io.ReadAll(resp.Body)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, ErrBodyTooLarge
+	}
+	return body, nil
+}
+
+// shouldRetry repete apenas erros 5xx, 429 e timeouts da tentativa. Se o
+// contexto da requisição original acabou, não adianta tentar de novo.
+func (f *HTTPFetcher) shouldRetry(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500 || statusErr.StatusCode == http.StatusTooManyRequests
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded)
+}
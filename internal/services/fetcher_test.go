@@ -0,0 +1,192 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestFetcher aponta o HTTPFetcher para um httptest.Server, com esperas
+// curtas para os testes de nova tentativa.
+func newTestFetcher(t *testing.T, handler http.HandlerFunc, configure func(*FetcherConfig)) (*HTTPFetcher, string) {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	config := DefaultFetcherConfig()
+	config.Backoff = 10 * time.Millisecond
+	config.Client = srv.Client()
+	if configure != nil {
+		configure(&config)
+	}
+	return NewHTTPFetcher(config), srv.URL
+}
+
+func TestHTTPFetcherSuccess(t *testing.T) {
+	var userAgent string
+	fetcher, url := newTestFetcher(t, func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.UserAgent()
+		w.Write([]byte("<html>nota</html>"))
+	}, nil)
+
+	body, err := fetcher.Fetch(context.Background(), url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "<html>nota</html>" {
+		t.Errorf("body = %q", body)
+	}
+	if userAgent != DefaultFetcherConfig().UserAgent {
+		t.Errorf("User-Agent = %q", userAgent)
+	}
+}
+
+func TestHTTPFetcherRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantAttempts int32
+		wantStatus   int
+	}{
+		{name: "5xx seguido de sucesso", statuses: []int{503, 200}, wantAttempts: 2},
+		{name: "429 seguido de sucesso", statuses: []int{429, 429, 200}, wantAttempts: 3},
+		{name: "5xx em todas as tentativas", statuses: []int{500, 502, 503, 200}, wantAttempts: 3, wantStatus: 503},
+		{name: "404 não é repetido", statuses: []int{404, 200}, wantAttempts: 1, wantStatus: 404},
+		{name: "403 não é repetido", statuses: []int{403, 200}, wantAttempts: 1, wantStatus: 403},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			fetcher, url := newTestFetcher(t, func(w http.ResponseWriter, r *http.Request) {
+				n := attempts.Add(1)
+				w.WriteHeader(tt.statuses[n-1])
+				w.Write([]byte("ok"))
+			}, func(c *FetcherConfig) { c.MaxRetries = 2 })
+
+			_, err := fetcher.Fetch(context.Background(), url)
+			if got := attempts.Load(); got != tt.wantAttempts {
+				t.Errorf("tentativas = %d, want %d", got, tt.wantAttempts)
+			}
+			if tt.wantStatus == 0 {
+				if err != nil {
+					t.Fatalf("err = %v", err)
+				}
+				return
+			}
+			var statusErr *HTTPStatusError
+			if !errors.As(err, &statusErr) || statusErr.StatusCode != tt.wantStatus {
+				t.Fatalf("err = %v, want HTTPStatusError %d", err, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestHTTPFetcherBackoffDoubles(t *testing.T) {
+	var times []time.Time
+	fetcher, url := newTestFetcher(t, func(w http.ResponseWriter, r *http.Request) {
+		times = append(times, time.Now())
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}, func(c *FetcherConfig) {
+		c.MaxRetries = 2
+		c.Backoff = 40 * time.Millisecond
+	})
+
+	if _, err := fetcher.Fetch(context.Background(), url); err == nil {
+		t.Fatal("esperava erro")
+	}
+	if len(times) != 3 {
+		t.Fatalf("tentativas = %d, want 3", len(times))
+	}
+	if first := times[1].Sub(times[0]); first < 40*time.Millisecond {
+		t.Errorf("primeira espera = %v, want >= 40ms", first)
+	}
+	if second := times[2].Sub(times[1]); second < 80*time.Millisecond {
+		t.Errorf("segunda espera = %v, want >= 80ms", second)
+	}
+}
+
+func TestHTTPFetcherRetriesTimeout(t *testing.T) {
+	var attempts atomic.Int32
+	fetcher, url := newTestFetcher(t, func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+			return
+		}
+		w.Write([]byte("ok"))
+	}, func(c *FetcherConfig) {
+		c.MaxRetries = 1
+		c.Timeout = 50 * time.Millisecond
+	})
+
+	body, err := fetcher.Fetch(context.Background(), url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "ok" || attempts.Load() != 2 {
+		t.Errorf("body = %q após %d tentativas", body, attempts.Load())
+	}
+}
+
+func TestHTTPFetcherStopsWhenContextEnds(t *testing.T) {
+	var attempts atomic.Int32
+	fetcher, url := newTestFetcher(t, func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}, func(c *FetcherConfig) {
+		c.MaxRetries = 5
+		c.Backoff = time.Second
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := fetcher.Fetch(ctx, url)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Fetch demorou %v após o fim do contexto", elapsed)
+	}
+	if attempts.Load() != 1 {
+		t.Errorf("tentativas = %d, want 1", attempts.Load())
+	}
+}
+
+func TestHTTPFetcherBodyLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		wantErr error
+	}{
+		{name: "abaixo do limite", size: 1023},
+		{name: "exatamente no limite", size: 1024},
+		{name: "acima do limite", size: 1025, wantErr: ErrBodyTooLarge},
+		{name: "muito acima do limite", size: 1 << 20, wantErr: ErrBodyTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetcher, url := newTestFetcher(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(strings.Repeat("a", tt.size)))
+			}, func(c *FetcherConfig) { c.MaxBodySize = 1024 })
+
+			body, err := fetcher.Fetch(context.Background(), url)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || len(body) != tt.size {
+				t.Fatalf("len(body) = %d, err = %v", len(body), err)
+			}
+		})
+	}
+}
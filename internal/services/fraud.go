@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/joaogustavosp/loyalty-api/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// DefaultFraudReviewScore é a pontuação de risco a partir da qual a nota vai
+// para a revisão manual.
+const DefaultFraudReviewScore = 50
+
+// FraudClaim é o resgate avaliado pelas regras antifraude.
+type FraudClaim struct {
+	User    models.User
+	Invoice models.Invoice
+	At      time.Time
+}
+
+// FraudRule é uma regra antifraude. Evaluate devolve a pontuação de risco e o
+// motivo, ou zero quando a regra não se aplica.
+type FraudRule interface {
+	Name() string
+	Evaluate(ctx context.Context, claim FraudClaim) (int, string, error)
+}
+
+// FraudAssessment é o resultado da avaliação: a soma das pontuações e os
+// motivos de cada regra que pontuou.
+type FraudAssessment struct {
+	Score   int
+	Reasons []string
+}
+
+// FraudEngine avalia cada nota resgatada com as regras antifraude.
+type FraudEngine struct {
+	userService *UserService
+	attempts    *ClaimAttemptLog
+	rules       []FraudRule
+	reviewScore int
+}
+
+func NewFraudEngine(userService *UserService, attempts *ClaimAttemptLog, reviewScore int, rules ...FraudRule) *FraudEngine {
+	return &FraudEngine{userService, attempts, rules, reviewScore}
+}
+
+// NeedsReview indica se a avaliação exige revisão manual.
+func (e *FraudEngine) NeedsReview(a FraudAssessment) bool {
+	return a.Score >= e.reviewScore
+}
+
+// RecordAttempt registra a tentativa de resgate de uma chave, inclusive as
+// recusadas por já ter sido resgatada, para a regra de chave compartilhada.
+func (e *FraudEngine) RecordAttempt(ctx context.Context, userID, accessKey string) {
+	if err := e.attempts.Record(ctx, userID, accessKey); err != nil {
+		log.Printf("erro ao registrar tentativa de resgate: %v", err)
+	}
+}
+
+// Assess roda todas as regras. Uma regra com erro é ignorada e registrada no
+// log, para que uma falha na consulta do histórico não impeça o resgate.
+func (e *FraudEngine) Assess(ctx context.Context, userID string, invoice models.Invoice) (FraudAssessment, error) {
+	user, err := e.userService.GetUser(ctx, userID)
+	if err != nil {
+		return FraudAssessment{}, err
+	}
+	user.ID = userID
+
+	claim := FraudClaim{User: user, Invoice: invoice, At: time.Now()}
+	var assessment FraudAssessment
+	for _, rule := range e.rules {
+		score, reason, err := rule.Evaluate(ctx, claim)
+		if err != nil {
+			log.Printf("erro na regra antifraude %s: %v", rule.Name(), err)
+			continue
+		}
+		if score > 0 {
+			assessment.Score += score
+			assessment.Reasons = append(assessment.Reasons, reason)
+		}
+	}
+	return assessment, nil
+}
+
+// ClaimAttemptLog guarda as tentativas de resgate por chave de acesso.
+type ClaimAttemptLog struct {
+	collection *mongo.Collection
+}
+
+func NewClaimAttemptLog(collection *mongo.Collection) *ClaimAttemptLog {
+	return &ClaimAttemptLog{collection}
+}
+
+func (l *ClaimAttemptLog) EnsureIndexes(ctx context.Context) error {
+	_, err := l.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "access_key", Value: 1}, {Key: "user_id", Value: 1}},
+	})
+	return err
+}
+
+func (l *ClaimAttemptLog) Record(ctx context.Context, userID, accessKey string) error {
+	_, err := l.collection.InsertOne(ctx, bson.M{"access_key": accessKey, "user_id": userID, "at": time.Now()})
+	return err
+}
+
+// OtherUsers conta quantas outras contas tentaram resgatar a chave.
+func (l *ClaimAttemptLog) OtherUsers(ctx context.Context, userID, accessKey string) (int, error) {
+	users, err := l.collection.Distinct(ctx, "user_id", bson.M{"access_key": accessKey, "user_id": bson.M{"$ne": userID}})
+	return len(users), err
+}
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/joaogustavosp/loyalty-api/internal/models"
+	"github.com/joaogustavosp/loyalty-api/internal/nfce"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DefaultFraudRules são as regras antifraude com os limites padrão.
+func DefaultFraudRules(invoices *mongo.Collection, attempts *ClaimAttemptLog) []FraudRule {
+	return []FraudRule{
+		SharedKeyRule{attempts, DefaultFraudReviewScore},
+		VelocityRule{invoices, time.Hour, 5, 30},
+		AmountRule{invoices, 20, 3, 5, 100 * 100, 25},
+		SequentialRule{invoices, 10, 3, 7 * 24 * time.Hour, 30},
+		CPFMismatchRule{50},
+	}
+}
+
+// SharedKeyRule pontua a chave de acesso que outras contas tentaram resgatar
+// antes da nota ser verificada, como na nota pendente. A tentativa posterior
+// ao resgate é tratada por InvoiceService.flagSharedKey.
+type SharedKeyRule struct {
+	Attempts *ClaimAttemptLog
+	Score    int
+}
+
+func (SharedKeyRule) Name() string { return "shared_key" }
+
+func (r SharedKeyRule) Evaluate(ctx context.Context, claim FraudClaim) (int, string, error) {
+	others, err := r.Attempts.OtherUsers(ctx, claim.User.ID, claim.Invoice.AccessKey)
+	if err != nil || others == 0 {
+		return 0, "", err
+	}
+	return r.Score, fmt.Sprintf("chave de acesso enviada por outras %d contas", others), nil
+}
+
+// VelocityRule pontua o usuário que resgata notas demais num intervalo.
+type VelocityRule struct {
+	Invoices *mongo.Collection
+	Window   time.Duration
+	Limit    int64
+	Score    int
+}
+
+func (VelocityRule) Name() string { return "velocity" }
+
+func (r VelocityRule) Evaluate(ctx context.Context, claim FraudClaim) (int, string, error) {
+	filter := bson.M{"user_id": claim.User.ID, "claimed_at": bson.M{"$gte": claim.At.Add(-r.Window)}}
+	count, err := r.Invoices.CountDocuments(ctx, filter)
+	if err != nil || count < r.Limit {
+		return 0, "", err
+	}
+	return r.Score, fmt.Sprintf("%d notas resgatadas em %s", count+1, r.Window), nil
+}
+
+// AmountRule pontua a nota com valor muito acima da média das últimas notas
+// verificadas do usuário.
+type AmountRule struct {
+	Invoices   *mongo.Collection
+	History    int64
+	MinHistory int
+	Factor     int64
+	// MinAmount evita pontuar compras pequenas de quem costuma gastar pouco
+	MinAmount models.Money
+	Score     int
+}
+
+func (AmountRule) Name() string { return "amount" }
+
+func (r AmountRule) Evaluate(ctx context.Context, claim FraudClaim) (int, string, error) {
+	net := claim.Invoice.Totals.Net
+	if net < r.MinAmount {
+		return 0, "", nil
+	}
+
+	filter := bson.M{"user_id": claim.User.ID, "status": models.InvoiceVerified}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "claimed_at", Value: -1}}).
+		SetLimit(r.History).
+		SetProjection(bson.M{"totals": 1})
+	cursor, err := r.Invoices.Find(ctx, filter, opts)
+	if err != nil {
+		return 0, "", err
+	}
+	var history []models.Invoice
+	if err := cursor.All(ctx, &history); err != nil {
+		return 0, "", err
+	}
+	if len(history) < r.MinHistory {
+		return 0, "", nil
+	}
+
+	var sum models.Money
+	for _, inv := range history {
+		sum += inv.Totals.Net
+	}
+	average := sum / models.Money(len(history))
+	if int64(net) <= int64(average)*r.Factor {
+		return 0, "", nil
+	}
+	return r.Score, fmt.Sprintf("valor de R$ %s acima de %dx a média de R$ %s", net, r.Factor, average), nil
+}
+
+// SequentialRule pontua a nota do mesmo emitente e série com números próximos
+// de outras resgatadas recentemente, típico de quem recolhe cupons abandonados
+// no caixa. Considera todas as contas, já que os cupons recolhidos costumam
+// ser espalhados entre várias; Window limita a busca aos resgates recentes,
+// para que o movimento normal de uma loja ao longo dos meses não pontue.
+type SequentialRule struct {
+	Invoices *mongo.Collection
+	Distance int
+	Limit    int
+	Window   time.Duration
+	Score    int
+}
+
+func (SequentialRule) Name() string { return "sequential" }
+
+func (r SequentialRule) Evaluate(ctx context.Context, claim FraudClaim) (int, string, error) {
+	number, err := strconv.Atoi(claim.Invoice.InvoiceNumber)
+	if err != nil || claim.Invoice.CNPJ == "" {
+		return 0, "", nil
+	}
+
+	filter := bson.M{
+		"cnpj":       claim.Invoice.CNPJ,
+		"series":     claim.Invoice.Series,
+		"claimed_at": bson.M{"$gte": claim.At.Add(-r.Window)},
+		"status":     bson.M{"$ne": models.InvoiceRejected},
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "claimed_at", Value: -1}}).
+		SetLimit(50).
+		SetProjection(bson.M{"invoice_number": 1, "user_id": 1})
+	cursor, err := r.Invoices.Find(ctx, filter, opts)
+	if err != nil {
+		return 0, "", err
+	}
+	var history []models.Invoice
+	if err := cursor.All(ctx, &history); err != nil {
+		return 0, "", err
+	}
+
+	nearby := 0
+	accounts := map[string]bool{claim.User.ID: true}
+	for _, inv := range history {
+		n, err := strconv.Atoi(inv.InvoiceNumber)
+		if err == nil && n != number && n >= number-r.Distance && n <= number+r.Distance {
+			nearby++
+			accounts[inv.UserID] = true
+		}
+	}
+	if nearby < r.Limit {
+		return 0, "", nil
+	}
+	return r.Score, fmt.Sprintf("%d notas do mesmo emitente com números próximos em %d contas", nearby+1, len(accounts)), nil
+}
+
+// CPFMismatchRule pontua a nota com o CPF de outra pessoa, aceita pela
+// política de CPF mas ainda suspeita.
+type CPFMismatchRule struct {
+	Score int
+}
+
+func (CPFMismatchRule) Name() string { return "cpf_mismatch" }
+
+func (r CPFMismatchRule) Evaluate(ctx context.Context, claim FraudClaim) (int, string, error) {
+	cpf := claim.Invoice.ConsumerCPF
+	if cpf == "" || nfce.ConsumerCPFMatches(cpf, claim.User.CPF) {
+		return 0, "", nil
+	}
+	return r.Score, "CPF da nota diferente do CPF do usuário", nil
+}
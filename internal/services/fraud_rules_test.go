@@ -0,0 +1,208 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joaogustavosp/loyalty-api/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// testClaim é o resgate avaliado nos testes das regras.
+func testClaim(invoice models.Invoice) FraudClaim {
+	return FraudClaim{
+		User:    models.User{ID: testUserID, CPF: "52998224725"},
+		Invoice: invoice,
+		At:      time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+// historyResponse é a resposta de um find com as notas informadas.
+func historyResponse(invoices ...bson.D) bson.D {
+	return mtest.CreateCursorResponse(0, "db.invoices", mtest.FirstBatch, invoices...)
+}
+
+func TestSharedKeyRule(t *testing.T) {
+	mt := newMockDB(t)
+
+	mt.Run("chave só do usuário", func(mt *mtest.T) {
+		rule := SharedKeyRule{NewClaimAttemptLog(mt.Coll), 50}
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "values", Value: bson.A{}}))
+
+		score, _, err := rule.Evaluate(context.Background(), testClaim(models.Invoice{AccessKey: testAccessKey}))
+		if err != nil || score != 0 {
+			t.Errorf("Evaluate = %d, %v, want 0", score, err)
+		}
+	})
+
+	mt.Run("chave tentada por outras contas", func(mt *mtest.T) {
+		rule := SharedKeyRule{NewClaimAttemptLog(mt.Coll), 50}
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "values", Value: bson.A{"outra", "mais uma"}}))
+
+		score, reason, err := rule.Evaluate(context.Background(), testClaim(models.Invoice{AccessKey: testAccessKey}))
+		if err != nil || score != 50 {
+			t.Fatalf("Evaluate = %d, %v, want 50", score, err)
+		}
+		if !strings.Contains(reason, "2 contas") {
+			t.Errorf("motivo = %q", reason)
+		}
+	})
+}
+
+func TestVelocityRule(t *testing.T) {
+	mt := newMockDB(t)
+	tests := []struct {
+		name  string
+		count int32
+		want  int
+	}{
+		{"abaixo do limite", 4, 0},
+		{"no limite", 5, 30},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			rule := VelocityRule{mt.Coll, time.Hour, 5, 30}
+			mt.AddMockResponses(countResponse(tt.count))
+
+			claim := testClaim(models.Invoice{})
+			score, _, err := rule.Evaluate(context.Background(), claim)
+			if err != nil || score != tt.want {
+				t.Fatalf("Evaluate = %d, %v, want %d", score, err, tt.want)
+			}
+			match := sentCommands(mt)[0].Lookup("pipeline", "0", "$match").Document()
+			if match.Lookup("user_id").StringValue() != testUserID {
+				t.Errorf("filtro = %v, want só o usuário", match)
+			}
+			if since := match.Lookup("claimed_at", "$gte").Time(); !since.Equal(claim.At.Add(-time.Hour)) {
+				t.Errorf("início da janela = %v", since)
+			}
+		})
+	}
+}
+
+func TestAmountRule(t *testing.T) {
+	mt := newMockDB(t)
+	verified := func(net models.Money) bson.D {
+		return bson.D{{Key: "totals", Value: bson.D{{Key: "net", Value: int64(net)}}}}
+	}
+	tests := []struct {
+		name     string
+		net      models.Money
+		history  []bson.D
+		want     int
+		noLookup bool
+	}{
+		{name: "compra pequena", net: 90 * 100, want: 0, noLookup: true},
+		{name: "histórico curto", net: 1000 * 100, history: []bson.D{verified(50 * 100), verified(50 * 100)}, want: 0},
+		{name: "dentro da média", net: 200 * 100, history: []bson.D{verified(50 * 100), verified(40 * 100), verified(60 * 100)}, want: 0},
+		{name: "muito acima da média", net: 300 * 100, history: []bson.D{verified(50 * 100), verified(40 * 100), verified(60 * 100)}, want: 25},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			rule := AmountRule{mt.Coll, 20, 3, 5, 100 * 100, 25}
+			mt.AddMockResponses(historyResponse(tt.history...))
+
+			invoice := models.Invoice{Totals: models.InvoiceTotals{Net: tt.net}}
+			score, reason, err := rule.Evaluate(context.Background(), testClaim(invoice))
+			if err != nil || score != tt.want {
+				t.Fatalf("Evaluate = %d, %q, %v, want %d", score, reason, err, tt.want)
+			}
+			commands := sentCommands(mt)
+			if tt.noLookup {
+				if len(commands) != 0 {
+					t.Errorf("comandos enviados = %v, want nenhum", commandNames(commands))
+				}
+				return
+			}
+			if status := commands[0].Lookup("filter", "status").StringValue(); status != string(models.InvoiceVerified) {
+				t.Errorf("filtro de status = %q, want só as verificadas", status)
+			}
+		})
+	}
+}
+
+func TestSequentialRule(t *testing.T) {
+	mt := newMockDB(t)
+	claimed := func(number, userID string) bson.D {
+		return bson.D{{Key: "invoice_number", Value: number}, {Key: "user_id", Value: userID}}
+	}
+	invoice := models.Invoice{CNPJ: "12345678000195", Series: "1", InvoiceNumber: "1000"}
+
+	mt.Run("números próximos em várias contas", func(mt *mtest.T) {
+		rule := SequentialRule{mt.Coll, 10, 3, 7 * 24 * time.Hour, 30}
+		mt.AddMockResponses(historyResponse(
+			claimed("1000", "outra"),
+			claimed("998", "outra"),
+			claimed("1003", "mais uma"),
+			claimed("1010", testUserID),
+			claimed("1500", "distante"),
+		))
+
+		claim := testClaim(invoice)
+		score, reason, err := rule.Evaluate(context.Background(), claim)
+		if err != nil || score != 30 {
+			t.Fatalf("Evaluate = %d, %v, want 30", score, err)
+		}
+		if !strings.Contains(reason, "4 notas") || !strings.Contains(reason, "3 contas") {
+			t.Errorf("motivo = %q", reason)
+		}
+
+		filter := sentCommands(mt)[0].Lookup("filter").Document()
+		if _, err := filter.LookupErr("user_id"); err == nil {
+			t.Errorf("filtro = %v, want todas as contas", filter)
+		}
+		if filter.Lookup("cnpj").StringValue() != invoice.CNPJ || filter.Lookup("series").StringValue() != invoice.Series {
+			t.Errorf("filtro = %v, want emitente e série da nota", filter)
+		}
+		if since := filter.Lookup("claimed_at", "$gte").Time(); !since.Equal(claim.At.Add(-7 * 24 * time.Hour)) {
+			t.Errorf("início da janela = %v", since)
+		}
+	})
+
+	mt.Run("poucas notas próximas", func(mt *mtest.T) {
+		rule := SequentialRule{mt.Coll, 10, 3, 7 * 24 * time.Hour, 30}
+		mt.AddMockResponses(historyResponse(claimed("999", "outra"), claimed("1001", "outra")))
+
+		score, _, err := rule.Evaluate(context.Background(), testClaim(invoice))
+		if err != nil || score != 0 {
+			t.Errorf("Evaluate = %d, %v, want 0", score, err)
+		}
+	})
+
+	mt.Run("número não numérico", func(mt *mtest.T) {
+		rule := SequentialRule{mt.Coll, 10, 3, 7 * 24 * time.Hour, 30}
+
+		score, _, err := rule.Evaluate(context.Background(), testClaim(models.Invoice{CNPJ: "12345678000195", InvoiceNumber: "A1"}))
+		if err != nil || score != 0 {
+			t.Errorf("Evaluate = %d, %v, want 0", score, err)
+		}
+		if commands := sentCommands(mt); len(commands) != 0 {
+			t.Errorf("comandos enviados = %v, want nenhum", commandNames(commands))
+		}
+	})
+}
+
+func TestCPFMismatchRule(t *testing.T) {
+	rule := CPFMismatchRule{50}
+	tests := []struct {
+		name string
+		cpf  string
+		want int
+	}{
+		{"sem CPF na nota", "", 0},
+		{"CPF do usuário", "52998224725", 0},
+		{"CPF mascarado compatível", "***.982.247-**", 0},
+		{"CPF de outra pessoa", "11144477735", 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score, _, err := rule.Evaluate(context.Background(), testClaim(models.Invoice{ConsumerCPF: tt.cpf}))
+			if err != nil || score != tt.want {
+				t.Errorf("Evaluate = %d, %v, want %d", score, err, tt.want)
+			}
+		})
+	}
+}
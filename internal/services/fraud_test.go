@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/joaogustavosp/loyalty-api/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// stubRule devolve sempre a mesma avaliação e guarda o resgate recebido.
+type stubRule struct {
+	name   string
+	score  int
+	reason string
+	err    error
+	claims *[]FraudClaim
+}
+
+func (r stubRule) Name() string { return r.name }
+
+func (r stubRule) Evaluate(ctx context.Context, claim FraudClaim) (int, string, error) {
+	if r.claims != nil {
+		*r.claims = append(*r.claims, claim)
+	}
+	return r.score, r.reason, r.err
+}
+
+// userResponse é a resposta do find de UserService.GetUser.
+func userResponse(cpf string) bson.D {
+	id, _ := primitive.ObjectIDFromHex(testUserID)
+	return mtest.CreateCursorResponse(0, "db.users", mtest.FirstBatch, bson.D{
+		{Key: "_id", Value: id},
+		{Key: "cpf", Value: cpf},
+	})
+}
+
+func TestFraudEngineAssess(t *testing.T) {
+	mt := newMockDB(t)
+
+	mt.Run("soma as regras que pontuam", func(mt *mtest.T) {
+		var claims []FraudClaim
+		engine := NewFraudEngine(NewUserService(mt.Coll), nil, 50,
+			stubRule{name: "a", score: 30, reason: "motivo a", claims: &claims},
+			stubRule{name: "b"},
+			stubRule{name: "c", score: 99, reason: "com erro", err: errors.New("falha na consulta")},
+			stubRule{name: "d", score: 25, reason: "motivo d"},
+		)
+		mt.AddMockResponses(userResponse("52998224725"))
+
+		invoice := models.Invoice{AccessKey: testAccessKey}
+		assessment, err := engine.Assess(context.Background(), testUserID, invoice)
+		if err != nil {
+			t.Fatalf("Assess err = %v", err)
+		}
+		want := FraudAssessment{Score: 55, Reasons: []string{"motivo a", "motivo d"}}
+		if !reflect.DeepEqual(assessment, want) {
+			t.Errorf("Assess = %+v, want %+v", assessment, want)
+		}
+		if !engine.NeedsReview(assessment) {
+			t.Error("NeedsReview = false, want true")
+		}
+
+		if len(claims) != 1 {
+			t.Fatalf("regra avaliada %d vezes", len(claims))
+		}
+		if claims[0].User.ID != testUserID || claims[0].User.CPF != "52998224725" || claims[0].Invoice.AccessKey != testAccessKey {
+			t.Errorf("resgate avaliado = %+v", claims[0])
+		}
+	})
+
+	mt.Run("usuário não encontrado", func(mt *mtest.T) {
+		engine := NewFraudEngine(NewUserService(mt.Coll), nil, 50, stubRule{name: "a", score: 30})
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.users", mtest.FirstBatch))
+
+		if _, err := engine.Assess(context.Background(), testUserID, models.Invoice{}); err == nil {
+			t.Fatal("Assess err = nil, want erro")
+		}
+	})
+}
+
+func TestFraudEngineNeedsReview(t *testing.T) {
+	engine := NewFraudEngine(nil, nil, 50)
+	tests := []struct {
+		score int
+		want  bool
+	}{
+		{0, false},
+		{49, false},
+		{50, true},
+		{120, true},
+	}
+	for _, tt := range tests {
+		if got := engine.NeedsReview(FraudAssessment{Score: tt.score}); got != tt.want {
+			t.Errorf("NeedsReview(%d) = %v, want %v", tt.score, got, tt.want)
+		}
+	}
+}
+
+func TestClaimAttemptLog(t *testing.T) {
+	mt := newMockDB(t)
+
+	mt.Run("registra a tentativa", func(mt *mtest.T) {
+		attempts := NewClaimAttemptLog(mt.Coll)
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+
+		if err := attempts.Record(context.Background(), testUserID, testAccessKey); err != nil {
+			t.Fatalf("Record err = %v", err)
+		}
+		doc := sentCommands(mt)[0].Lookup("documents", "0").Document()
+		if doc.Lookup("user_id").StringValue() != testUserID || doc.Lookup("access_key").StringValue() != testAccessKey {
+			t.Errorf("tentativa gravada = %v", doc)
+		}
+	})
+
+	mt.Run("conta as outras contas", func(mt *mtest.T) {
+		attempts := NewClaimAttemptLog(mt.Coll)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "values", Value: bson.A{"outra", "mais uma"}}))
+
+		others, err := attempts.OtherUsers(context.Background(), testUserID, testAccessKey)
+		if err != nil {
+			t.Fatalf("OtherUsers err = %v", err)
+		}
+		if others != 2 {
+			t.Errorf("OtherUsers = %d, want 2", others)
+		}
+		cmd := sentCommands(mt)[0]
+		if ne := cmd.Lookup("query", "user_id", "$ne").StringValue(); ne != testUserID {
+			t.Errorf("filtro user_id $ne = %q, want o próprio usuário", ne)
+		}
+	})
+}
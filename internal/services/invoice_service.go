@@ -0,0 +1,375 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/joaogustavosp/loyalty-api/internal/models"
+	"github.com/joaogustavosp/loyalty-api/internal/nfce"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrInvoiceAlreadyClaimed = errors.New("invoice already claimed")
+	ErrMissingAccessKey      = errors.New("invoice access key not found")
+)
+
+// pointsPerReal é a quantidade de pontos por real pago na nota.
+const pointsPerReal = 1
+
+// activeClaimStatuses são as situações em que a nota reserva a chave de
+// acesso. A nota rejeitada libera a chave: quem enviou o QR Code de outra
+// pessoa com a SEFAZ fora do ar não pode bloquear o resgate pelo dono.
+var activeClaimStatuses = bson.A{models.InvoicePending, models.InvoiceInReview, models.InvoiceVerified}
+
+// pendingLease é por quanto tempo uma nota pendente fica reservada para a
+// verificação em andamento, antes de poder ser pega de novo.
+const pendingLease = 10 * time.Minute
+
+type InvoiceService struct {
+	collection  *mongo.Collection
+	userService *UserService
+	agePolicy   ReceiptAgePolicy
+	cpfVerifier *CPFVerifier
+	fraudEngine *FraudEngine
+}
+
+// NewInvoiceService cria o serviço de resgate. Com cpfVerifier nil o CPF do
+// consumidor não é conferido e com fraudEngine nil as notas não passam pelas
+// regras antifraude.
+func NewInvoiceService(collection *mongo.Collection, userService *UserService, agePolicy ReceiptAgePolicy, cpfVerifier *CPFVerifier, fraudEngine *FraudEngine) *InvoiceService {
+	return &InvoiceService{collection, userService, agePolicy, cpfVerifier, fraudEngine}
+}
+
+// EnsureIndexes cria o índice único da chave de acesso, que garante que uma
+// nota só possa ser resgatada uma vez mesmo com requisições concorrentes, e os
+// índices da busca das notas pendentes e das regras antifraude. O índice
+// único é parcial, só das notas em activeClaimStatuses, e o filtro com $in
+// exige o MongoDB 6.0.
+func (s *InvoiceService) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "access_key", Value: 1}},
+			Options: options.Index().
+				SetName("access_key_active").
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"status": bson.M{"$in": activeClaimStatuses}}),
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "claimed_at", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "cnpj", Value: 1}, {Key: "series", Value: 1}, {Key: "claimed_at", Value: -1}},
+		},
+	})
+	return err
+}
+
+// PointsFor calcula os pontos de uma nota pelo valor líquido pago.
+func PointsFor(invoice models.Invoice) int64 {
+	return int64(invoice.Totals.Net) * pointsPerReal / 100
+}
+
+// assess roda as regras antifraude e define a situação da nota: verificada,
+// com os pontos, ou em revisão manual, sem pontos até a aprovação.
+func (s *InvoiceService) assess(ctx context.Context, userID string, invoice *models.Invoice, now time.Time) error {
+	invoice.Status = models.InvoiceVerified
+	if s.fraudEngine != nil {
+		assessment, err := s.fraudEngine.Assess(ctx, userID, *invoice)
+		if err != nil {
+			return err
+		}
+		invoice.FraudScore = assessment.Score
+		invoice.FraudReasons = assessment.Reasons
+		if s.fraudEngine.NeedsReview(assessment) {
+			invoice.Status = models.InvoiceInReview
+			return nil
+		}
+	}
+	invoice.VerifiedAt = &now
+	invoice.Points = PointsFor(*invoice)
+	return nil
+}
+
+// recordAttempt registra a tentativa de resgate para as regras antifraude.
+func (s *InvoiceService) recordAttempt(ctx context.Context, userID, accessKey string) {
+	if s.fraudEngine != nil {
+		s.fraudEngine.RecordAttempt(ctx, userID, accessKey)
+	}
+}
+
+// sharedKeyReason é o motivo gravado na nota enviada para revisão por
+// flagSharedKey.
+const sharedKeyReason = "chave de acesso enviada também por outra conta"
+
+// flagSharedKey manda para a revisão manual a nota verificada cuja chave outra
+// conta tentou resgatar: o cupom pode ter sido fotografado no caixa ou
+// recolhido de outra pessoa, e não há como saber qual conta é a dona. Os
+// pontos creditados são estornados e voltam na aprovação. As notas pendentes
+// não mudam, já que SharedKeyRule as avalia na verificação. Falhas vão para o
+// log: a tentativa já é recusada como resgate repetido.
+func (s *InvoiceService) flagSharedKey(ctx context.Context, userID, accessKey string) {
+	if s.fraudEngine == nil {
+		return
+	}
+	filter := bson.M{"access_key": accessKey, "status": models.InvoiceVerified, "user_id": bson.M{"$ne": userID}}
+	update := bson.M{
+		"$set":      bson.M{"status": models.InvoiceInReview},
+		"$unset":    bson.M{"points": "", "verified_at": ""},
+		"$max":      bson.M{"fraud_score": s.fraudEngine.reviewScore},
+		"$addToSet": bson.M{"fraud_reasons": sharedKeyReason},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.Before)
+
+	var flagged models.Invoice
+	err := s.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&flagged)
+	if err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			log.Printf("erro ao enviar para revisão a nota de chave %s: %v", accessKey, err)
+		}
+		return
+	}
+	if flagged.Points > 0 {
+		if err := s.userService.AddPoints(ctx, flagged.UserID, -flagged.Points); err != nil {
+			log.Printf("erro ao estornar os pontos da nota %s: %v", flagged.ID, err)
+		}
+	}
+}
+
+// checkClaim aplica as regras de resgate: prazo da nota em relação ao envio
+// e CPF do consumidor.
+func (s *InvoiceService) checkClaim(ctx context.Context, userID string, invoice models.Invoice, submittedAt time.Time) error {
+	if len(invoice.AccessKey) != 44 {
+		return ErrMissingAccessKey
+	}
+	if err := s.agePolicy.Check(invoice, submittedAt); err != nil {
+		return err
+	}
+	if s.cpfVerifier != nil {
+		if err := s.cpfVerifier.Verify(ctx, userID, invoice); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *InvoiceService) ClaimInvoice(ctx context.Context, userID string, invoice models.Invoice, products []models.ProductInvoice) (models.Invoice, error) {
+	now := time.Now()
+	if err := s.checkClaim(ctx, userID, invoice, now); err != nil {
+		return models.Invoice{}, err
+	}
+	s.recordAttempt(ctx, userID, invoice.AccessKey)
+
+	exists, err := s.InvoiceExistsByAccessKey(ctx, invoice.AccessKey)
+	if err != nil {
+		return models.Invoice{}, err
+	}
+	if exists {
+		s.flagSharedKey(ctx, userID, invoice.AccessKey)
+		return models.Invoice{}, ErrInvoiceAlreadyClaimed
+	}
+
+	invoice.ID = ""
+	invoice.UserID = userID
+	invoice.Products = products
+	invoice.ClaimedAt = &now
+	if err := s.assess(ctx, userID, &invoice, now); err != nil {
+		return models.Invoice{}, err
+	}
+
+	result, err := s.collection.InsertOne(ctx, invoice)
+	if err != nil {
+		// O índice único cobre a corrida entre a verificação e a inserção
+		if mongo.IsDuplicateKeyError(err) {
+			s.flagSharedKey(ctx, userID, invoice.AccessKey)
+			return models.Invoice{}, ErrInvoiceAlreadyClaimed
+		}
+		return models.Invoice{}, err
+	}
+	if id, ok := result.InsertedID.(primitive.ObjectID); ok {
+		invoice.ID = id.Hex()
+	}
+
+	if invoice.Points > 0 {
+		if err := s.userService.AddPoints(ctx, userID, invoice.Points); err != nil {
+			return models.Invoice{}, err
+		}
+	}
+	return invoice, nil
+}
+
+// ClaimPending registra o resgate de uma nota que não pôde ser consultada
+// agora. Ela guarda a chave de acesso, impedindo o resgate por outro usuário,
+// e é verificada em segundo plano até maxPending depois do envio. A nota que
+// pelo ano e mês da chave já está fora do prazo é recusada de imediato.
+func (s *InvoiceService) ClaimPending(ctx context.Context, userID, rawURL string, maxPending time.Duration, cause error) (models.Invoice, error) {
+	payload, err := nfce.ParseQRPayload(rawURL)
+	if err != nil {
+		return models.Invoice{}, err
+	}
+
+	now := time.Now()
+	var invoice models.Invoice
+	payload.AccessKey.Apply(&invoice)
+	if err := s.agePolicy.Check(invoice, now); err != nil {
+		return models.Invoice{}, err
+	}
+	s.recordAttempt(ctx, userID, invoice.AccessKey)
+
+	exists, err := s.InvoiceExistsByAccessKey(ctx, invoice.AccessKey)
+	if err != nil {
+		return models.Invoice{}, err
+	}
+	if exists {
+		s.flagSharedKey(ctx, userID, invoice.AccessKey)
+		return models.Invoice{}, ErrInvoiceAlreadyClaimed
+	}
+
+	until := now.Add(maxPending)
+	next := now.Add(pendingBackoff(0, ClassifyError(cause)))
+	invoice.UserID = userID
+	invoice.ClaimedAt = &now
+	invoice.Status = models.InvoicePending
+	invoice.SourceURL = rawURL
+	invoice.NextAttemptAt = &next
+	invoice.PendingUntil = &until
+
+	result, err := s.collection.InsertOne(ctx, invoice)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			s.flagSharedKey(ctx, userID, invoice.AccessKey)
+			return models.Invoice{}, ErrInvoiceAlreadyClaimed
+		}
+		return models.Invoice{}, err
+	}
+	if id, ok := result.InsertedID.(primitive.ObjectID); ok {
+		invoice.ID = id.Hex()
+	}
+	return invoice, nil
+}
+
+// nextPending reserva a próxima nota pendente com tentativa vencida,
+// adiando a sua próxima tentativa pelo tempo da reserva.
+func (s *InvoiceService) nextPending(ctx context.Context) (models.Invoice, error) {
+	now := time.Now()
+	filter := bson.M{"status": models.InvoicePending, "next_attempt_at": bson.M{"$lte": now}}
+	update := bson.M{
+		"$set": bson.M{"next_attempt_at": now.Add(pendingLease)},
+		"$inc": bson.M{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var invoice models.Invoice
+	err := s.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&invoice)
+	return invoice, err
+}
+
+// verifyPending completa a nota pendente com os dados extraídos, aplica as
+// regras de resgate na data do envio e credita os pontos.
+func (s *InvoiceService) verifyPending(ctx context.Context, pending, extracted models.Invoice, products []models.ProductInvoice) (models.Invoice, error) {
+	if err := s.checkClaim(ctx, pending.UserID, extracted, *pending.ClaimedAt); err != nil {
+		return models.Invoice{}, err
+	}
+
+	now := time.Now()
+	invoice := extracted
+	invoice.ID = ""
+	invoice.UserID = pending.UserID
+	invoice.Products = products
+	invoice.ClaimedAt = pending.ClaimedAt
+	invoice.Attempts = pending.Attempts
+	if err := s.assess(ctx, pending.UserID, &invoice, now); err != nil {
+		return models.Invoice{}, err
+	}
+
+	objID, _ := primitive.ObjectIDFromHex(pending.ID)
+	filter := bson.M{"_id": objID, "status": models.InvoicePending}
+	result, err := s.collection.ReplaceOne(ctx, filter, invoice)
+	if err != nil {
+		return models.Invoice{}, err
+	}
+	// Outra instância já resolveu a nota
+	if result.MatchedCount == 0 {
+		return models.Invoice{}, mongo.ErrNoDocuments
+	}
+	invoice.ID = pending.ID
+
+	if invoice.Points > 0 {
+		if err := s.userService.AddPoints(ctx, invoice.UserID, invoice.Points); err != nil {
+			return models.Invoice{}, err
+		}
+	}
+	return invoice, nil
+}
+
+// rejectPending encerra a verificação da nota pendente com o motivo da falha.
+// A nota rejeitada deixa de reservar a chave de acesso.
+func (s *InvoiceService) rejectPending(ctx context.Context, pending models.Invoice, cause *ExtractError) (models.Invoice, error) {
+	objID, _ := primitive.ObjectIDFromHex(pending.ID)
+	filter := bson.M{"_id": objID, "status": models.InvoicePending}
+	update := bson.M{
+		"$set": bson.M{
+			"status":           models.InvoiceRejected,
+			"rejection_code":   cause.Code,
+			"rejection_reason": cause.Error(),
+		},
+		"$unset": bson.M{"next_attempt_at": "", "source_url": ""},
+	}
+	result, err := s.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return models.Invoice{}, err
+	}
+	if result.MatchedCount == 0 {
+		return models.Invoice{}, mongo.ErrNoDocuments
+	}
+
+	pending.Status = models.InvoiceRejected
+	pending.RejectionCode = string(cause.Code)
+	pending.RejectionReason = cause.Error()
+	pending.NextAttemptAt = nil
+	return pending, nil
+}
+
+// reschedulePending agenda a próxima tentativa de uma nota pendente.
+func (s *InvoiceService) reschedulePending(ctx context.Context, pending models.Invoice, next time.Time) error {
+	objID, _ := primitive.ObjectIDFromHex(pending.ID)
+	filter := bson.M{"_id": objID, "status": models.InvoicePending}
+	update := bson.M{"$set": bson.M{"next_attempt_at": next}}
+	_, err := s.collection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+// InvoiceExistsByAccessKey indica se a chave já foi resgatada. As notas
+// rejeitadas não contam, como no índice único.
+func (s *InvoiceService) InvoiceExistsByAccessKey(ctx context.Context, accessKey string) (bool, error) {
+	filter := bson.M{"access_key": accessKey, "status": bson.M{"$ne": models.InvoiceRejected}}
+	count, err := s.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (s *InvoiceService) GetUserInvoices(ctx context.Context, userID string) ([]models.Invoice, error) {
+	filter := bson.M{"user_id": userID}
+	opts := options.Find().SetSort(bson.D{{Key: "claimed_at", Value: -1}})
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	invoices := []models.Invoice{}
+	if err := cursor.All(ctx, &invoices); err != nil {
+		return nil, err
+	}
+	return invoices, nil
+}
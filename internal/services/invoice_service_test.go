@@ -0,0 +1,198 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/joaogustavosp/loyalty-api/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestClaimPending(t *testing.T) {
+	mt := newMockDB(t)
+
+	mt.Run("nota fora do prazo pelo mês da chave", func(mt *mtest.T) {
+		s := NewInvoiceService(mt.Coll, nil, DefaultReceiptAgePolicy(), nil, nil)
+		_, err := s.ClaimPending(context.Background(), testUserID, testQRCodeURL, 0, nil)
+		if !errors.Is(err, ErrInvoiceTooOld) {
+			t.Fatalf("ClaimPending err = %v, want ErrInvoiceTooOld", err)
+		}
+		if names := commandNames(sentCommands(mt)); len(names) != 0 {
+			t.Errorf("comandos enviados = %v, want nenhum", names)
+		}
+	})
+
+	mt.Run("reserva a chave", func(mt *mtest.T) {
+		s := NewInvoiceService(mt.Coll, nil, ReceiptAgePolicy{}, nil, nil)
+		mt.AddMockResponses(countResponse(0), mtest.CreateSuccessResponse())
+
+		invoice, err := s.ClaimPending(context.Background(), testUserID, testQRCodeURL, 0, nil)
+		if err != nil {
+			t.Fatalf("ClaimPending err = %v", err)
+		}
+		if invoice.Status != models.InvoicePending || invoice.ID == "" || invoice.AccessKey != testAccessKey {
+			t.Errorf("ClaimPending = %+v", invoice)
+		}
+		if invoice.NextAttemptAt == nil || invoice.PendingUntil == nil {
+			t.Errorf("ClaimPending sem agenda: %+v", invoice)
+		}
+
+		commands := sentCommands(mt)
+		if names := commandNames(commands); !reflect.DeepEqual(names, []string{"aggregate", "insert"}) {
+			t.Fatalf("comandos enviados = %v", names)
+		}
+		// A contagem ignora as notas rejeitadas, como o índice único
+		ne := commands[0].Lookup("pipeline", "0", "$match", "status", "$ne").StringValue()
+		if ne != string(models.InvoiceRejected) {
+			t.Errorf("filtro de status = %q, want $ne %s", ne, models.InvoiceRejected)
+		}
+	})
+
+	mt.Run("chave já resgatada", func(mt *mtest.T) {
+		s := NewInvoiceService(mt.Coll, nil, ReceiptAgePolicy{}, nil, nil)
+		mt.AddMockResponses(countResponse(1))
+
+		_, err := s.ClaimPending(context.Background(), testUserID, testQRCodeURL, 0, nil)
+		if !errors.Is(err, ErrInvoiceAlreadyClaimed) {
+			t.Fatalf("ClaimPending err = %v, want ErrInvoiceAlreadyClaimed", err)
+		}
+	})
+
+	mt.Run("corrida com outra inserção", func(mt *mtest.T) {
+		s := NewInvoiceService(mt.Coll, nil, ReceiptAgePolicy{}, nil, nil)
+		mt.AddMockResponses(countResponse(0), mtest.CreateWriteErrorsResponse(mtest.WriteError{
+			Index: 0, Code: 11000, Message: "duplicate key error",
+		}))
+
+		_, err := s.ClaimPending(context.Background(), testUserID, testQRCodeURL, 0, nil)
+		if !errors.Is(err, ErrInvoiceAlreadyClaimed) {
+			t.Fatalf("ClaimPending err = %v, want ErrInvoiceAlreadyClaimed", err)
+		}
+	})
+}
+
+func TestEnsureIndexes(t *testing.T) {
+	mt := newMockDB(t)
+
+	mt.Run("cria o índice único parcial", func(mt *mtest.T) {
+		s := NewInvoiceService(mt.Coll, nil, ReceiptAgePolicy{}, nil, nil)
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		if err := s.EnsureIndexes(context.Background()); err != nil {
+			t.Fatalf("EnsureIndexes err = %v", err)
+		}
+
+		commands := sentCommands(mt)
+		if names := commandNames(commands); !reflect.DeepEqual(names, []string{"createIndexes"}) {
+			t.Fatalf("comandos enviados = %v", names)
+		}
+		unique := commands[0].Lookup("indexes", "0")
+		if name := unique.Document().Lookup("name").StringValue(); name != "access_key_active" {
+			t.Errorf("nome do índice = %q", name)
+		}
+		if !unique.Document().Lookup("unique").Boolean() {
+			t.Error("índice da chave de acesso não é único")
+		}
+		values, err := unique.Document().Lookup("partialFilterExpression", "status", "$in").Array().Values()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var statuses []string
+		for _, v := range values {
+			statuses = append(statuses, v.StringValue())
+		}
+		want := []string{"PENDING", "IN_REVIEW", "VERIFIED"}
+		if !reflect.DeepEqual(statuses, want) {
+			t.Errorf("filtro parcial = %v, want %v", statuses, want)
+		}
+	})
+}
+
+func TestClaimInvoiceFlagsSharedKey(t *testing.T) {
+	mt := newMockDB(t)
+	const otherUserID = "64b7f0c2a1b2c3d4e5f6071a"
+	claimed := models.Invoice{AccessKey: testAccessKey}
+
+	newService := func(mt *mtest.T) *InvoiceService {
+		users := NewUserService(mt.Coll)
+		engine := NewFraudEngine(users, NewClaimAttemptLog(mt.Coll), 50)
+		return NewInvoiceService(mt.Coll, users, ReceiptAgePolicy{}, nil, engine)
+	}
+
+	mt.Run("nota verificada vai para revisão com estorno", func(mt *mtest.T) {
+		s := newService(mt)
+		owner := append(reviewedDocument(models.InvoiceVerified), bson.E{Key: "points", Value: int64(58)})
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(),
+			countResponse(1),
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: owner}),
+			updateResponse(1),
+		)
+
+		_, err := s.ClaimInvoice(context.Background(), otherUserID, claimed, nil)
+		if !errors.Is(err, ErrInvoiceAlreadyClaimed) {
+			t.Fatalf("ClaimInvoice err = %v, want ErrInvoiceAlreadyClaimed", err)
+		}
+
+		commands := sentCommands(mt)
+		if names := commandNames(commands); !reflect.DeepEqual(names, []string{"insert", "aggregate", "findAndModify", "update"}) {
+			t.Fatalf("comandos enviados = %v", names)
+		}
+		flag := commands[2]
+		if status := flag.Lookup("query", "status").StringValue(); status != string(models.InvoiceVerified) {
+			t.Errorf("filtro de status = %q, want só a nota verificada", status)
+		}
+		if ne := flag.Lookup("query", "user_id", "$ne").StringValue(); ne != otherUserID {
+			t.Errorf("filtro user_id $ne = %q, want a conta que tentou", ne)
+		}
+		if status := flag.Lookup("update", "$set", "status").StringValue(); status != string(models.InvoiceInReview) {
+			t.Errorf("situação gravada = %q", status)
+		}
+		if score := flag.Lookup("update", "$max", "fraud_score").Int32(); score != 50 {
+			t.Errorf("fraud_score = %d, want a pontuação de revisão", score)
+		}
+		if reason := flag.Lookup("update", "$addToSet", "fraud_reasons").StringValue(); reason != sharedKeyReason {
+			t.Errorf("motivo = %q", reason)
+		}
+
+		refund := commands[3].Lookup("updates", "0")
+		if id := refund.Document().Lookup("q", "_id").ObjectID().Hex(); id != testUserID {
+			t.Errorf("estorno para %s, want o dono da nota %s", id, testUserID)
+		}
+		if points := refund.Document().Lookup("u", "$inc", "points").Int64(); points != -58 {
+			t.Errorf("estorno = %d, want -58", points)
+		}
+	})
+
+	mt.Run("chave reservada por nota pendente", func(mt *mtest.T) {
+		s := newService(mt)
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(),
+			countResponse(1),
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}),
+		)
+
+		_, err := s.ClaimInvoice(context.Background(), otherUserID, claimed, nil)
+		if !errors.Is(err, ErrInvoiceAlreadyClaimed) {
+			t.Fatalf("ClaimInvoice err = %v, want ErrInvoiceAlreadyClaimed", err)
+		}
+		if names := commandNames(sentCommands(mt)); !reflect.DeepEqual(names, []string{"insert", "aggregate", "findAndModify"}) {
+			t.Errorf("comandos enviados = %v, want sem estorno", names)
+		}
+	})
+
+	mt.Run("sem regras antifraude", func(mt *mtest.T) {
+		s := NewInvoiceService(mt.Coll, NewUserService(mt.Coll), ReceiptAgePolicy{}, nil, nil)
+		mt.AddMockResponses(countResponse(1))
+
+		_, err := s.ClaimInvoice(context.Background(), otherUserID, claimed, nil)
+		if !errors.Is(err, ErrInvoiceAlreadyClaimed) {
+			t.Fatalf("ClaimInvoice err = %v, want ErrInvoiceAlreadyClaimed", err)
+		}
+		if names := commandNames(sentCommands(mt)); !reflect.DeepEqual(names, []string{"aggregate"}) {
+			t.Errorf("comandos enviados = %v", names)
+		}
+	})
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/joaogustavosp/loyalty-api/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	jobMaxAttempts  = 5
+	jobRetryBackoff = 30 * time.Second
+	jobPollInterval = 5 * time.Second
+	// As notas em contingência têm até 24 horas para serem transmitidas; a
+	// consulta é repetida de hora em hora por pouco mais que esse prazo
+	jobContingencyMaxAttempts = 30
+	jobContingencyBackoff     = time.Hour
+)
+
+var ErrJobNotFound = errors.New("job not found")
+
+// JobService processa extrações em segundo plano com um número fixo de
+// workers. Os jobs ficam no Mongo, então os que estavam na fila ou em execução
+// quando o processo parou são retomados no próximo Start.
+type JobService struct {
+	collection     *mongo.Collection
+	extractService *ExtractService
+	workers        int
+	wake           chan struct{}
+}
+
+func NewJobService(collection *mongo.Collection, extractService *ExtractService, workers int) *JobService {
+	if workers < 1 {
+		workers = 1
+	}
+	return &JobService{
+		collection:     collection,
+		extractService: extractService,
+		workers:        workers,
+		wake:           make(chan struct{}, workers),
+	}
+}
+
+func (s *JobService) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}}},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+	})
+	return err
+}
+
+// Start devolve à fila os jobs interrompidos e inicia os workers, que param
+// quando ctx é cancelado.
+func (s *JobService) Start(ctx context.Context) error {
+	filter := bson.M{"status": models.JobRunning}
+	update := bson.M{"$set": bson.M{"status": models.JobQueued, "updated_at": time.Now()}}
+	if _, err := s.collection.UpdateMany(ctx, filter, update); err != nil {
+		return err
+	}
+
+	for i := 0; i < s.workers; i++ {
+		go s.worker(ctx)
+	}
+	return nil
+}
+
+func (s *JobService) Submit(ctx context.Context, userID, rawURL string) (models.ExtractionJob, error) {
+	// Rejeitar URLs inválidas já na criação do job
+	if _, _, err := s.extractService.ValidateURL(rawURL); err != nil {
+		return models.ExtractionJob{}, err
+	}
+
+	now := time.Now()
+	job := models.ExtractionJob{
+		UserID:        userID,
+		URL:           rawURL,
+		Status:        models.JobQueued,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	result, err := s.collection.InsertOne(ctx, job)
+	if err != nil {
+		return models.ExtractionJob{}, err
+	}
+	if id, ok := result.InsertedID.(primitive.ObjectID); ok {
+		job.ID = id.Hex()
+	}
+
+	// Acordar um worker sem bloquear; se todos estiverem ocupados, o job é
+	// encontrado na próxima busca
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+func (s *JobService) GetJob(ctx context.Context, userID, id string) (models.ExtractionJob, error) {
+	var job models.ExtractionJob
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return job, ErrJobNotFound
+	}
+	filter := bson.M{"_id": objID, "user_id": userID}
+	err = s.collection.FindOne(ctx, filter).Decode(&job)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return job, ErrJobNotFound
+	}
+	return job, err
+}
+
+func (s *JobService) worker(ctx context.Context) {
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			job, err := s.claimNext(ctx)
+			if err != nil {
+				if !errors.Is(err, mongo.ErrNoDocuments) && ctx.Err() == nil {
+					log.Printf("erro ao buscar job de extração: %v", err)
+				}
+				break
+			}
+			s.run(ctx, job)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// claimNext marca como RUNNING o próximo job vencido da fila. A atualização é
+// atômica, então dois workers nunca pegam o mesmo job.
+func (s *JobService) claimNext(ctx context.Context) (models.ExtractionJob, error) {
+	now := time.Now()
+	filter := bson.M{
+		"status":          bson.M{"$in": []models.JobStatus{models.JobQueued, models.JobRetrying}},
+		"next_attempt_at": bson.M{"$lte": now},
+	}
+	update := bson.M{
+		"$set": bson.M{"status": models.JobRunning, "updated_at": now},
+		"$inc": bson.M{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var job models.ExtractionJob
+	err := s.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&job)
+	return job, err
+}
+
+func (s *JobService) run(ctx context.Context, job models.ExtractionJob) {
+	// A falha da tentativa anterior ainda pode estar no cache
+	extract := s.extractService.ExtractData
+	if job.Attempts > 1 {
+		extract = s.extractService.Refetch
+	}
+	products, invoice, err := extract(ctx, job.URL)
+
+	extractErr := ClassifyError(err)
+
+	now := time.Now()
+	set := bson.M{"updated_at": now}
+	switch {
+	case extractErr == nil:
+		set["status"] = models.JobSucceeded
+		set["invoice"] = invoice
+		set["products"] = products
+		set["error"] = ""
+		set["error_code"] = ""
+	case extractErr.Code == CodeContingencyPending && job.Attempts < jobContingencyMaxAttempts:
+		set["status"] = models.JobRetrying
+		set["error"] = extractErr.Error()
+		set["error_code"] = extractErr.Code
+		set["next_attempt_at"] = now.Add(jobContingencyBackoff)
+	case extractErr.Retryable() && job.Attempts < jobMaxAttempts:
+		set["status"] = models.JobRetrying
+		set["error"] = extractErr.Error()
+		set["error_code"] = extractErr.Code
+		set["next_attempt_at"] = now.Add(jobRetryBackoff << (job.Attempts - 1))
+	default:
+		set["status"] = models.JobFailed
+		set["error"] = extractErr.Error()
+		set["error_code"] = extractErr.Code
+	}
+
+	objID, _ := primitive.ObjectIDFromHex(job.ID)
+	if _, err := s.collection.UpdateOne(ctx, bson.M{"_id": objID}, bson.M{"$set": set}); err != nil {
+		log.Printf("erro ao atualizar job de extração %s: %v", job.ID, err)
+	}
+}
@@ -0,0 +1,192 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/joaogustavosp/loyalty-api/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// testJob é o job da nota do corpus na tentativa informada.
+func testJob(attempts int) models.ExtractionJob {
+	return models.ExtractionJob{
+		ID:       testInvoiceID,
+		UserID:   testUserID,
+		URL:      testQRCodeURL,
+		Status:   models.JobRunning,
+		Attempts: attempts,
+	}
+}
+
+func TestJobRetryBypassesCache(t *testing.T) {
+	mt := newMockDB(t)
+
+	mt.Run("nova tentativa consulta a SEFAZ de novo", func(mt *mtest.T) {
+		fetcher := &countingFetcher{Fetcher: stubFetcher{err: &HTTPStatusError{StatusCode: http.StatusServiceUnavailable, Status: "503 Service Unavailable"}}}
+		// A falha fica no cache por mais tempo que o intervalo da nova tentativa
+		cache := NewLRUCache(10, time.Hour)
+		s := NewJobService(mt.Coll, NewExtractService(fetcher, nil, cache), 1)
+		mt.AddMockResponses(updateResponse(1), updateResponse(1), updateResponse(1))
+
+		s.run(context.Background(), testJob(1))
+		s.run(context.Background(), testJob(2))
+		if calls := fetcher.calls.Load(); calls != 2 {
+			t.Errorf("consultas = %d, want 2", calls)
+		}
+
+		// Fora das novas tentativas a falha recente continua reaproveitada
+		if _, _, err := s.extractService.ExtractData(context.Background(), testQRCodeURL); err == nil {
+			t.Fatal("ExtractData err = nil, want a falha em cache")
+		}
+		if calls := fetcher.calls.Load(); calls != 2 {
+			t.Errorf("consultas = %d, want 2 com a falha em cache", calls)
+		}
+	})
+}
+
+func TestJobSubmit(t *testing.T) {
+	mt := newMockDB(t)
+
+	mt.Run("enfileira a URL válida", func(mt *mtest.T) {
+		s := NewJobService(mt.Coll, NewExtractService(stubFetcher{}, nil, nil), 1)
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+
+		job, err := s.Submit(context.Background(), testUserID, testQRCodeURL)
+		if err != nil {
+			t.Fatalf("Submit err = %v", err)
+		}
+		if job.ID == "" || job.Status != models.JobQueued || job.UserID != testUserID || job.NextAttemptAt.IsZero() {
+			t.Errorf("Submit = %+v", job)
+		}
+	})
+
+	mt.Run("recusa a URL inválida sem gravar", func(mt *mtest.T) {
+		s := NewJobService(mt.Coll, NewExtractService(stubFetcher{}, nil, nil), 1)
+
+		if _, err := s.Submit(context.Background(), testUserID, "https://www.nfce.fazenda.sp.gov.br/qrcode?p=123"); ClassifyError(err).Code != CodeInvalidURL {
+			t.Fatalf("Submit err = %v, want INVALID_URL", err)
+		}
+		if names := commandNames(sentCommands(mt)); len(names) != 0 {
+			t.Errorf("comandos enviados = %v, want nenhum", names)
+		}
+	})
+}
+
+func TestJobClaimNext(t *testing.T) {
+	mt := newMockDB(t)
+
+	mt.Run("marca o próximo job vencido como em execução", func(mt *mtest.T) {
+		s := NewJobService(mt.Coll, nil, 1)
+		id, _ := primitive.ObjectIDFromHex(testInvoiceID)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.D{
+			{Key: "_id", Value: id},
+			{Key: "url", Value: testQRCodeURL},
+			{Key: "status", Value: models.JobRunning},
+			{Key: "attempts", Value: 1},
+		}}))
+
+		job, err := s.claimNext(context.Background())
+		if err != nil {
+			t.Fatalf("claimNext err = %v", err)
+		}
+		if job.ID != testInvoiceID || job.Attempts != 1 {
+			t.Errorf("claimNext = %+v", job)
+		}
+
+		cmd := sentCommands(mt)[0]
+		values, _ := cmd.Lookup("query", "status", "$in").Array().Values()
+		var statuses []string
+		for _, v := range values {
+			statuses = append(statuses, v.StringValue())
+		}
+		if !reflect.DeepEqual(statuses, []string{"QUEUED", "RETRYING"}) {
+			t.Errorf("filtro de status = %v", statuses)
+		}
+		if status := cmd.Lookup("update", "$set", "status").StringValue(); status != string(models.JobRunning) {
+			t.Errorf("situação gravada = %q", status)
+		}
+		if inc := cmd.Lookup("update", "$inc", "attempts").Int32(); inc != 1 {
+			t.Errorf("$inc attempts = %d", inc)
+		}
+	})
+
+	mt.Run("fila vazia", func(mt *mtest.T) {
+		s := NewJobService(mt.Coll, nil, 1)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}))
+
+		if _, err := s.claimNext(context.Background()); !errors.Is(err, mongo.ErrNoDocuments) {
+			t.Fatalf("claimNext err = %v, want ErrNoDocuments", err)
+		}
+	})
+}
+
+func TestJobRun(t *testing.T) {
+	unavailable := stubFetcher{err: &HTTPStatusError{StatusCode: http.StatusServiceUnavailable, Status: "503 Service Unavailable"}}
+	contingency := stubFetcher{err: ErrContingencyPending}
+	tests := []struct {
+		name     string
+		fetcher  Fetcher
+		attempts int
+		status   models.JobStatus
+		code     ErrorCode
+		// backoff é o intervalo até a próxima tentativa; zero quando o job
+		// termina
+		backoff time.Duration
+	}{
+		{name: "extraída", fetcher: stubFetcher{body: fixturePage(t)}, attempts: 1, status: models.JobSucceeded},
+		{name: "SEFAZ fora do ar na primeira tentativa", fetcher: unavailable, attempts: 1, status: models.JobRetrying, code: CodeSefazUnavailable, backoff: jobRetryBackoff},
+		{name: "intervalo dobra a cada tentativa", fetcher: unavailable, attempts: 3, status: models.JobRetrying, code: CodeSefazUnavailable, backoff: 4 * jobRetryBackoff},
+		{name: "SEFAZ fora do ar na última tentativa", fetcher: unavailable, attempts: jobMaxAttempts, status: models.JobFailed, code: CodeSefazUnavailable},
+		{name: "nota não encontrada", fetcher: stubFetcher{err: &HTTPStatusError{StatusCode: http.StatusNotFound, Status: "404 Not Found"}}, attempts: 1, status: models.JobFailed, code: CodeInvoiceNotFound},
+		{name: "contingência de hora em hora", fetcher: contingency, attempts: jobMaxAttempts, status: models.JobRetrying, code: CodeContingencyPending, backoff: jobContingencyBackoff},
+		{name: "contingência na última tentativa", fetcher: contingency, attempts: jobContingencyMaxAttempts, status: models.JobFailed, code: CodeContingencyPending},
+	}
+
+	mt := newMockDB(t)
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			s := NewJobService(mt.Coll, NewExtractService(tt.fetcher, nil, nil), 1)
+			mt.AddMockResponses(updateResponse(1))
+
+			before := time.Now()
+			s.run(context.Background(), testJob(tt.attempts))
+
+			cmd := sentCommands(mt)[0].Lookup("updates", "0").Document()
+			if id := cmd.Lookup("q", "_id").ObjectID().Hex(); id != testInvoiceID {
+				t.Errorf("job atualizado = %s", id)
+			}
+			set := cmd.Lookup("u", "$set").Document()
+			if status := set.Lookup("status").StringValue(); status != string(tt.status) {
+				t.Errorf("situação = %q, want %q", status, tt.status)
+			}
+			if code := set.Lookup("error_code").StringValue(); code != string(tt.code) {
+				t.Errorf("error_code = %q, want %q", code, tt.code)
+			}
+
+			next, err := set.LookupErr("next_attempt_at")
+			if tt.backoff == 0 {
+				if err == nil {
+					t.Errorf("next_attempt_at = %v no job encerrado", next.Time())
+				}
+			} else if err != nil {
+				t.Error("next_attempt_at ausente")
+			} else if want := before.Add(tt.backoff); next.Time().Before(want.Add(-time.Second)) || next.Time().After(want.Add(time.Minute)) {
+				t.Errorf("next_attempt_at = %v, want perto de %v", next.Time(), want)
+			}
+
+			if tt.status == models.JobSucceeded {
+				if key := set.Lookup("invoice", "access_key").StringValue(); key != testAccessKey {
+					t.Errorf("nota gravada com chave %q", key)
+				}
+			}
+		})
+	}
+}
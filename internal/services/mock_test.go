@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/joaogustavosp/loyalty-api/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// Nota de SP do corpus em internal/nfce/testdata, usada nos testes que passam
+// pela extração.
+const (
+	testAccessKey = "35230512345678000195650010000123451000123454"
+	testQRCodeURL = "https://www.nfce.fazenda.sp.gov.br/NFCeConsultaPublica/Paginas/ConsultaQRCode.aspx?p=" + testAccessKey + "|2|1|1|ABCDEF"
+	testUserID    = "64b7f0c2a1b2c3d4e5f60718"
+	testInvoiceID = "64b7f0c2a1b2c3d4e5f60719"
+)
+
+// newMockDB cria um cliente do MongoDB sem servidor, que responde a cada
+// comando com a próxima resposta enfileirada por AddMockResponses.
+func newMockDB(t *testing.T) *mtest.T {
+	return mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+}
+
+// sentCommands devolve, em ordem, os comandos enviados ao servidor.
+func sentCommands(mt *mtest.T) []bson.Raw {
+	mt.Helper()
+	var commands []bson.Raw
+	for evt := mt.GetStartedEvent(); evt != nil; evt = mt.GetStartedEvent() {
+		commands = append(commands, evt.Command)
+	}
+	return commands
+}
+
+// commandNames devolve os nomes dos comandos enviados, como "insert" ou
+// "update".
+func commandNames(commands []bson.Raw) []string {
+	names := make([]string, len(commands))
+	for i, cmd := range commands {
+		if elems, err := cmd.Elements(); err == nil && len(elems) > 0 {
+			names[i] = elems[0].Key()
+		}
+	}
+	return names
+}
+
+// countResponse é a resposta do aggregate usado por CountDocuments.
+func countResponse(n int32) bson.D {
+	return mtest.CreateCursorResponse(0, "db.invoices", mtest.FirstBatch, bson.D{{Key: "n", Value: n}})
+}
+
+// stubFetcher devolve sempre a mesma página ou o mesmo erro.
+type stubFetcher struct {
+	body []byte
+	err  error
+}
+
+func (f stubFetcher) Fetch(ctx context.Context, rawURL string) ([]byte, error) {
+	return f.body, f.err
+}
+
+// countingFetcher conta as consultas feitas ao fetcher envolvido.
+type countingFetcher struct {
+	Fetcher
+	calls atomic.Int32
+}
+
+func (f *countingFetcher) Fetch(ctx context.Context, rawURL string) ([]byte, error) {
+	f.calls.Add(1)
+	return f.Fetcher.Fetch(ctx, rawURL)
+}
+
+func fixturePage(t *testing.T) []byte {
+	t.Helper()
+	body, err := os.ReadFile("../nfce/testdata/sp/pix_dinheiro_troco.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+// recordingNotifier guarda as notas avisadas e sinaliza cada aviso.
+type recordingNotifier struct {
+	mu       sync.Mutex
+	invoices []models.Invoice
+	notified chan struct{}
+}
+
+func newRecordingNotifier() *recordingNotifier {
+	return &recordingNotifier{notified: make(chan struct{}, 10)}
+}
+
+func (n *recordingNotifier) NotifyInvoice(ctx context.Context, invoice models.Invoice) error {
+	n.mu.Lock()
+	n.invoices = append(n.invoices, invoice)
+	n.mu.Unlock()
+	n.notified <- struct{}{}
+	return nil
+}
+
+func (n *recordingNotifier) all() []models.Invoice {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]models.Invoice(nil), n.invoices...)
+}
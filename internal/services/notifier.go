@@ -0,0 +1,57 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"html"
+
+	"github.com/joaogustavosp/loyalty-api/internal/email"
+	"github.com/joaogustavosp/loyalty-api/internal/models"
+)
+
+// InvoiceNotifier avisa o usuário do resultado da verificação de uma nota.
+type InvoiceNotifier interface {
+	NotifyInvoice(ctx context.Context, invoice models.Invoice) error
+}
+
+// EmailNotifier envia o aviso por email.
+type EmailNotifier struct {
+	userService *UserService
+	sender      *email.EmailSender
+}
+
+func NewEmailNotifier(userService *UserService, sender *email.EmailSender) *EmailNotifier {
+	return &EmailNotifier{userService, sender}
+}
+
+func (n *EmailNotifier) NotifyInvoice(ctx context.Context, invoice models.Invoice) error {
+	user, err := n.userService.GetUser(ctx, invoice.UserID)
+	if err != nil {
+		return err
+	}
+
+	var subject, body string
+	switch invoice.Status {
+	case models.InvoiceVerified:
+		subject = "Nota fiscal verificada"
+		body = fmt.Sprintf("<p>Sua nota fiscal de %s no valor de R$ %s foi verificada.</p><p>Você ganhou %d pontos!</p>",
+			html.EscapeString(merchantName(invoice)), invoice.Totals.Net, invoice.Points)
+	case models.InvoiceRejected:
+		subject = "Nota fiscal não aprovada"
+		body = fmt.Sprintf("<p>Não foi possível validar a sua nota fiscal de chave %s.</p><p>Motivo: %s</p>",
+			invoice.AccessKey, html.EscapeString(invoice.RejectionReason))
+	default:
+		return nil
+	}
+	return n.sender.SendEmail(user.Email, subject, body)
+}
+
+func merchantName(invoice models.Invoice) string {
+	if invoice.Merchant.TradeName != "" {
+		return invoice.Merchant.TradeName
+	}
+	if invoice.Merchant.Name != "" {
+		return invoice.Merchant.Name
+	}
+	return invoice.CNPJ
+}
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/joaogustavosp/loyalty-api/internal/models"
+	"github.com/joaogustavosp/loyalty-api/internal/nfce"
+)
+
+var ErrInvoiceFromFuture = errors.New("data de emissão da nota no futuro")
+
+// ReceiptAgePolicy define a janela de datas de emissão aceitas no resgate,
+// para que notas antigas não sejam usadas para acumular pontos.
+type ReceiptAgePolicy struct {
+	// MaxAge é a idade máxima da nota; zero desativa o limite
+	MaxAge time.Duration
+	// MaxFuture tolera relógios adiantados do emitente
+	MaxFuture time.Duration
+}
+
+// DefaultReceiptAgePolicy aceita notas de até 30 dias e até 10 minutos no
+// futuro.
+func DefaultReceiptAgePolicy() ReceiptAgePolicy {
+	return ReceiptAgePolicy{
+		MaxAge:    30 * 24 * time.Hour,
+		MaxFuture: 10 * time.Minute,
+	}
+}
+
+// Check confere a data de emissão da nota. Sem IssuedAt vale o mês da chave
+// de acesso, com o benefício da dúvida: o fim do mês para a idade e o início
+// para a data futura.
+func (p ReceiptAgePolicy) Check(invoice models.Invoice, now time.Time) error {
+	var earliest, latest time.Time
+	var issued string
+	switch {
+	case invoice.IssuedAt != nil:
+		earliest, latest = *invoice.IssuedAt, *invoice.IssuedAt
+		issued = invoice.IssuedAt.In(nfce.Location).Format("02/01/2006 15:04:05")
+	case invoice.IssueYear > 0:
+		earliest = time.Date(invoice.IssueYear, time.Month(invoice.IssueMonth), 1, 0, 0, 0, 0, nfce.Location)
+		latest = earliest.AddDate(0, 1, 0)
+		issued = earliest.Format("01/2006")
+	default:
+		return nil
+	}
+
+	if p.MaxAge > 0 && now.Sub(latest) > p.MaxAge {
+		return fmt.Errorf("%w: emitida em %s, limite de %d dias", ErrInvoiceTooOld, issued, int(p.MaxAge.Hours()/24))
+	}
+	if earliest.Sub(now) > p.MaxFuture {
+		return fmt.Errorf("%w: emitida em %s", ErrInvoiceFromFuture, issued)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/joaogustavosp/loyalty-api/internal/models"
+	"github.com/joaogustavosp/loyalty-api/internal/nfce"
+)
+
+func TestReceiptAgePolicyCheck(t *testing.T) {
+	policy := ReceiptAgePolicy{MaxAge: 30 * 24 * time.Hour, MaxFuture: 10 * time.Minute}
+	issued := time.Date(2024, 5, 10, 12, 0, 0, 0, nfce.Location)
+	issuedAt := func(t time.Time) models.Invoice { return models.Invoice{IssuedAt: &t} }
+	// Sem data de emissão vale o mês da chave, até o início de junho
+	keyMonth := models.Invoice{IssueYear: 2024, IssueMonth: 5}
+	endOfMonth := time.Date(2024, 6, 1, 0, 0, 0, 0, nfce.Location)
+
+	tests := []struct {
+		name    string
+		policy  ReceiptAgePolicy
+		invoice models.Invoice
+		now     time.Time
+		want    error
+	}{
+		{name: "emitida agora", policy: policy, invoice: issuedAt(issued), now: issued},
+		{name: "no limite da idade", policy: policy, invoice: issuedAt(issued), now: issued.Add(30 * 24 * time.Hour)},
+		{name: "um segundo depois do limite", policy: policy, invoice: issuedAt(issued), now: issued.Add(30*24*time.Hour + time.Second), want: ErrInvoiceTooOld},
+		{name: "um dia depois do limite", policy: policy, invoice: issuedAt(issued), now: issued.Add(31 * 24 * time.Hour), want: ErrInvoiceTooOld},
+		{name: "futuro dentro da tolerância", policy: policy, invoice: issuedAt(issued), now: issued.Add(-10 * time.Minute)},
+		{name: "futuro além da tolerância", policy: policy, invoice: issuedAt(issued), now: issued.Add(-11 * time.Minute), want: ErrInvoiceFromFuture},
+		{name: "mês da chave no limite", policy: policy, invoice: keyMonth, now: endOfMonth.Add(30 * 24 * time.Hour)},
+		{name: "mês da chave um dia depois do limite", policy: policy, invoice: keyMonth, now: endOfMonth.Add(31 * 24 * time.Hour), want: ErrInvoiceTooOld},
+		{name: "mês da chave ainda não começou", policy: policy, invoice: keyMonth, now: time.Date(2024, 4, 30, 12, 0, 0, 0, nfce.Location), want: ErrInvoiceFromFuture},
+		{name: "data de emissão prevalece sobre o mês da chave", policy: policy, invoice: models.Invoice{IssuedAt: &issued, IssueYear: 2024, IssueMonth: 6}, now: issued.Add(31 * 24 * time.Hour), want: ErrInvoiceTooOld},
+		{name: "sem limite de idade", policy: ReceiptAgePolicy{}, invoice: issuedAt(issued), now: issued.AddDate(5, 0, 0)},
+		{name: "sem data", policy: policy, invoice: models.Invoice{}, now: issued},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Check(tt.invoice, tt.now)
+			if tt.want == nil && err != nil || tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("Check err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
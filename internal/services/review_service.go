@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/joaogustavosp/loyalty-api/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrReviewNotFound = errors.New("nota fiscal não está em revisão")
+
+// ReviewService é a fila de revisão manual das notas com risco de fraude,
+// operada pelos administradores em /api/v1/admin/reviews.
+type ReviewService struct {
+	invoiceService *InvoiceService
+	notifier       InvoiceNotifier
+}
+
+func NewReviewService(invoiceService *InvoiceService, notifier InvoiceNotifier) *ReviewService {
+	return &ReviewService{invoiceService, notifier}
+}
+
+// Queue lista as notas em revisão, da mais arriscada para a menos.
+func (s *ReviewService) Queue(ctx context.Context, limit int64) ([]models.Invoice, error) {
+	filter := bson.M{"status": models.InvoiceInReview}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "fraud_score", Value: -1}, {Key: "claimed_at", Value: 1}}).
+		SetLimit(limit)
+	cursor, err := s.invoiceService.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	invoices := []models.Invoice{}
+	if err := cursor.All(ctx, &invoices); err != nil {
+		return nil, err
+	}
+	return invoices, nil
+}
+
+// Approve verifica a nota em revisão e credita os pontos ao usuário.
+func (s *ReviewService) Approve(ctx context.Context, id string) (models.Invoice, error) {
+	now := time.Now()
+	invoice, err := s.resolve(ctx, id, bson.M{"status": models.InvoiceVerified, "verified_at": now})
+	if err != nil {
+		return models.Invoice{}, err
+	}
+
+	// Os pontos são gravados depois de resolvida a revisão, para que duas
+	// aprovações concorrentes não creditem duas vezes
+	points := PointsFor(invoice)
+	objID, _ := primitive.ObjectIDFromHex(invoice.ID)
+	if _, err := s.invoiceService.collection.UpdateOne(ctx, bson.M{"_id": objID}, bson.M{"$set": bson.M{"points": points}}); err != nil {
+		return models.Invoice{}, err
+	}
+	if err := s.invoiceService.userService.AddPoints(ctx, invoice.UserID, points); err != nil {
+		return models.Invoice{}, err
+	}
+	invoice.Points = points
+
+	s.notify(ctx, invoice)
+	return invoice, nil
+}
+
+// Reject recusa a nota em revisão com o motivo informado ao usuário.
+func (s *ReviewService) Reject(ctx context.Context, id, reason string) (models.Invoice, error) {
+	invoice, err := s.resolve(ctx, id, bson.M{
+		"status":           models.InvoiceRejected,
+		"rejection_code":   "FRAUD_REVIEW",
+		"rejection_reason": reason,
+	})
+	if err != nil {
+		return models.Invoice{}, err
+	}
+	s.notify(ctx, invoice)
+	return invoice, nil
+}
+
+// resolve tira a nota da fila com uma atualização condicionada à situação em
+// revisão e devolve a nota atualizada.
+func (s *ReviewService) resolve(ctx context.Context, id string, set bson.M) (models.Invoice, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.Invoice{}, ErrReviewNotFound
+	}
+	filter := bson.M{"_id": objID, "status": models.InvoiceInReview}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var invoice models.Invoice
+	err = s.invoiceService.collection.FindOneAndUpdate(ctx, filter, bson.M{"$set": set}, opts).Decode(&invoice)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.Invoice{}, ErrReviewNotFound
+	}
+	return invoice, err
+}
+
+func (s *ReviewService) notify(ctx context.Context, invoice models.Invoice) {
+	if s.notifier == nil {
+		return
+	}
+	// O resultado da revisão já foi gravado; a falha no aviso não o desfaz
+	if err := s.notifier.NotifyInvoice(ctx, invoice); err != nil {
+		log.Printf("erro ao avisar o usuário %s sobre a nota %s: %v", invoice.UserID, invoice.AccessKey, err)
+	}
+}
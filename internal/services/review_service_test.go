@@ -0,0 +1,184 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/joaogustavosp/loyalty-api/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// reviewedDocument é a nota devolvida pelo findAndModify da revisão.
+func reviewedDocument(status models.InvoiceStatus) bson.D {
+	id, _ := primitive.ObjectIDFromHex(testInvoiceID)
+	return bson.D{
+		{Key: "_id", Value: id},
+		{Key: "user_id", Value: testUserID},
+		{Key: "access_key", Value: testAccessKey},
+		{Key: "status", Value: status},
+		{Key: "totals", Value: bson.D{{Key: "net", Value: int64(5800)}}},
+		{Key: "fraud_score", Value: 60},
+	}
+}
+
+func newTestReview(mt *mtest.T) (*ReviewService, *recordingNotifier) {
+	invoices := NewInvoiceService(mt.Coll, NewUserService(mt.Coll), ReceiptAgePolicy{}, nil, nil)
+	notifier := newRecordingNotifier()
+	return NewReviewService(invoices, notifier), notifier
+}
+
+func TestReviewQueue(t *testing.T) {
+	mt := newMockDB(t)
+
+	mt.Run("lista as notas em revisão", func(mt *mtest.T) {
+		s, _ := newTestReview(mt)
+		mt.AddMockResponses(historyResponse(reviewedDocument(models.InvoiceInReview)))
+
+		invoices, err := s.Queue(context.Background(), 20)
+		if err != nil {
+			t.Fatalf("Queue err = %v", err)
+		}
+		if len(invoices) != 1 || invoices[0].ID != testInvoiceID || invoices[0].FraudScore != 60 {
+			t.Errorf("Queue = %+v", invoices)
+		}
+
+		cmd := sentCommands(mt)[0]
+		if status := cmd.Lookup("filter", "status").StringValue(); status != string(models.InvoiceInReview) {
+			t.Errorf("filtro de status = %q", status)
+		}
+		if limit := cmd.Lookup("limit").Int64(); limit != 20 {
+			t.Errorf("limit = %d, want 20", limit)
+		}
+		sort, _ := cmd.Lookup("sort").Document().Elements()
+		if len(sort) == 0 || sort[0].Key() != "fraud_score" {
+			t.Errorf("ordem = %v, want fraud_score primeiro", sort)
+		}
+	})
+
+	mt.Run("fila vazia", func(mt *mtest.T) {
+		s, _ := newTestReview(mt)
+		mt.AddMockResponses(historyResponse())
+
+		invoices, err := s.Queue(context.Background(), 20)
+		if err != nil || invoices == nil || len(invoices) != 0 {
+			t.Errorf("Queue = %v, %v, want lista vazia", invoices, err)
+		}
+	})
+}
+
+func TestReviewApprove(t *testing.T) {
+	mt := newMockDB(t)
+
+	mt.Run("credita os pontos e avisa", func(mt *mtest.T) {
+		s, notifier := newTestReview(mt)
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: reviewedDocument(models.InvoiceVerified)}),
+			updateResponse(1),
+			updateResponse(1),
+		)
+
+		invoice, err := s.Approve(context.Background(), testInvoiceID)
+		if err != nil {
+			t.Fatalf("Approve err = %v", err)
+		}
+		if invoice.Points != 58 {
+			t.Errorf("pontos = %d, want 58", invoice.Points)
+		}
+
+		commands := sentCommands(mt)
+		if names := commandNames(commands); !reflect.DeepEqual(names, []string{"findAndModify", "update", "update"}) {
+			t.Fatalf("comandos enviados = %v", names)
+		}
+		if status := commands[0].Lookup("query", "status").StringValue(); status != string(models.InvoiceInReview) {
+			t.Errorf("filtro de status = %q, want só as notas em revisão", status)
+		}
+		if status := commands[0].Lookup("update", "$set", "status").StringValue(); status != string(models.InvoiceVerified) {
+			t.Errorf("situação gravada = %q", status)
+		}
+		if points := commands[1].Lookup("updates", "0", "u", "$set", "points").Int64(); points != 58 {
+			t.Errorf("pontos gravados = %d", points)
+		}
+		if points := commands[2].Lookup("updates", "0", "u", "$inc", "points").Int64(); points != 58 {
+			t.Errorf("pontos creditados = %d", points)
+		}
+
+		got := notifier.all()
+		if len(got) != 1 || got[0].Status != models.InvoiceVerified || got[0].Points != 58 {
+			t.Errorf("avisos = %+v", got)
+		}
+	})
+
+	mt.Run("nota fora da fila", func(mt *mtest.T) {
+		s, notifier := newTestReview(mt)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}))
+
+		if _, err := s.Approve(context.Background(), testInvoiceID); !errors.Is(err, ErrReviewNotFound) {
+			t.Fatalf("Approve err = %v, want ErrReviewNotFound", err)
+		}
+		if names := commandNames(sentCommands(mt)); len(names) != 1 {
+			t.Errorf("comandos enviados = %v, want sem crédito de pontos", names)
+		}
+		if got := notifier.all(); len(got) != 0 {
+			t.Errorf("avisos = %+v, want nenhum", got)
+		}
+	})
+
+	mt.Run("id inválido", func(mt *mtest.T) {
+		s, _ := newTestReview(mt)
+
+		if _, err := s.Approve(context.Background(), "não é um id"); !errors.Is(err, ErrReviewNotFound) {
+			t.Fatalf("Approve err = %v, want ErrReviewNotFound", err)
+		}
+		if names := commandNames(sentCommands(mt)); len(names) != 0 {
+			t.Errorf("comandos enviados = %v, want nenhum", names)
+		}
+	})
+}
+
+func TestReviewReject(t *testing.T) {
+	mt := newMockDB(t)
+
+	mt.Run("recusa e avisa com o motivo", func(mt *mtest.T) {
+		s, notifier := newTestReview(mt)
+		rejected := append(reviewedDocument(models.InvoiceRejected),
+			bson.E{Key: "rejection_code", Value: "FRAUD_REVIEW"},
+			bson.E{Key: "rejection_reason", Value: "cupom de outra pessoa"},
+		)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: rejected}))
+
+		invoice, err := s.Reject(context.Background(), testInvoiceID, "cupom de outra pessoa")
+		if err != nil {
+			t.Fatalf("Reject err = %v", err)
+		}
+		if invoice.Status != models.InvoiceRejected || invoice.Points != 0 {
+			t.Errorf("Reject = %+v", invoice)
+		}
+
+		commands := sentCommands(mt)
+		if names := commandNames(commands); !reflect.DeepEqual(names, []string{"findAndModify"}) {
+			t.Fatalf("comandos enviados = %v, want sem crédito de pontos", names)
+		}
+		set := commands[0].Lookup("update", "$set").Document()
+		if set.Lookup("rejection_code").StringValue() != "FRAUD_REVIEW" || set.Lookup("rejection_reason").StringValue() != "cupom de outra pessoa" {
+			t.Errorf("$set = %v", set)
+		}
+
+		got := notifier.all()
+		if len(got) != 1 || got[0].Status != models.InvoiceRejected || got[0].RejectionReason != "cupom de outra pessoa" {
+			t.Errorf("avisos = %+v", got)
+		}
+	})
+
+	mt.Run("nota fora da fila", func(mt *mtest.T) {
+		s, _ := newTestReview(mt)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}))
+
+		if _, err := s.Reject(context.Background(), testInvoiceID, "motivo"); !errors.Is(err, ErrReviewNotFound) {
+			t.Fatalf("Reject err = %v, want ErrReviewNotFound", err)
+		}
+	})
+}
@@ -30,6 +30,8 @@ func (s *UserService) CreateUser(ctx context.Context, user models.User) (*mongo.
 	if exists {
 		return nil, errors.New("CPF already exists")
 	}
+	user.Points = 0
+	user.Role = ""
 	return s.collection.InsertOne(ctx, user)
 }
 
@@ -71,6 +73,11 @@ func (s *UserService) UpdateUser(ctx context.Context, id string, user models.Use
 	if user.Status == "" {
 		user.Status = existingUser.Status
 	}
+
+	// O saldo de pontos só muda por AddPoints e o perfil só no banco; zerados,
+	// ficam fora do $set
+	user.Points = 0
+	user.Role = ""
 	update := bson.M{"$set": user}
 	return s.collection.UpdateOne(ctx, filter, update)
 }
@@ -110,3 +117,24 @@ func (s *UserService) GetUserByCPF(ctx context.Context, cpf string) (models.User
 	err := s.collection.FindOne(ctx, filter).Decode(&user)
 	return user, err
 }
+
+// AddPoints credita pontos ao usuário com um incremento atômico.
+func (s *UserService) AddPoints(ctx context.Context, userID string, points int64) error {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return err
+	}
+	filter := bson.M{"_id": objID}
+	update := bson.M{"$inc": bson.M{"points": points}}
+	_, err = s.collection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+// IsAdmin indica se o usuário tem o perfil de administrador.
+func (s *UserService) IsAdmin(ctx context.Context, userID string) (bool, error) {
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return user.Role == models.RoleAdmin, nil
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/joaogustavosp/loyalty-api/internal/models"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	verificationPollInterval = time.Minute
+	// pendingBaseBackoff dobra a cada tentativa até pendingMaxBackoff
+	pendingBaseBackoff = 5 * time.Minute
+	pendingMaxBackoff  = 6 * time.Hour
+)
+
+// Pendable indica se a falha permite guardar o resgate como pendente: a SEFAZ
+// estava fora do ar ou a nota em contingência ainda não foi transmitida.
+func (e *ExtractError) Pendable() bool {
+	return e.Code == CodeSefazUnavailable || e.Code == CodeContingencyPending
+}
+
+// pendingBackoff calcula o intervalo até a próxima tentativa. As notas em
+// contingência são consultadas de hora em hora, já que dependem do
+// estabelecimento transmiti-las.
+func pendingBackoff(attempts int, cause *ExtractError) time.Duration {
+	if cause != nil && cause.Code == CodeContingencyPending {
+		return time.Hour
+	}
+	backoff := pendingBaseBackoff
+	for i := 0; i < attempts && backoff < pendingMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > pendingMaxBackoff {
+		backoff = pendingMaxBackoff
+	}
+	return backoff
+}
+
+// VerificationService consulta de novo as notas pendentes até verificá-las,
+// creditando os pontos, ou rejeitá-las, avisando o usuário do resultado.
+type VerificationService struct {
+	invoiceService *InvoiceService
+	extractService *ExtractService
+	notifier       InvoiceNotifier
+	maxPending     time.Duration
+}
+
+// NewVerificationService cria o agendador. maxPending é o prazo, a partir do
+// envio, para que a nota pendente seja encontrada na SEFAZ.
+func NewVerificationService(invoiceService *InvoiceService, extractService *ExtractService, notifier InvoiceNotifier, maxPending time.Duration) *VerificationService {
+	return &VerificationService{invoiceService, extractService, notifier, maxPending}
+}
+
+// MaxPending é o prazo para a verificação de uma nota pendente.
+func (s *VerificationService) MaxPending() time.Duration {
+	return s.maxPending
+}
+
+// Start verifica as notas pendentes em segundo plano até ctx ser cancelado.
+func (s *VerificationService) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(verificationPollInterval)
+		defer ticker.Stop()
+
+		for {
+			for {
+				pending, err := s.invoiceService.nextPending(ctx)
+				if err != nil {
+					if !errors.Is(err, mongo.ErrNoDocuments) && ctx.Err() == nil {
+						log.Printf("erro ao buscar nota pendente: %v", err)
+					}
+					break
+				}
+				s.verify(ctx, pending)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (s *VerificationService) verify(ctx context.Context, pending models.Invoice) {
+	products, extracted, err := s.extractService.Refetch(ctx, pending.SourceURL)
+	if err == nil {
+		invoice, err := s.invoiceService.verifyPending(ctx, pending, extracted, products)
+		if err == nil {
+			s.notify(ctx, invoice)
+			return
+		}
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return
+		}
+		// Nota encontrada, mas fora das regras de resgate
+		if extractErr := ClassifyError(err); extractErr.Code != CodeInternal {
+			s.reject(ctx, pending, extractErr)
+			return
+		}
+		log.Printf("erro ao verificar nota pendente %s: %v", pending.ID, err)
+	}
+
+	extractErr := ClassifyError(err)
+	now := time.Now()
+	next := now.Add(pendingBackoff(pending.Attempts, extractErr))
+	retryable := extractErr.Pendable() || extractErr.Code == CodeInternal
+	if retryable && pending.PendingUntil != nil && next.Before(*pending.PendingUntil) {
+		if err := s.invoiceService.reschedulePending(ctx, pending, next); err != nil {
+			log.Printf("erro ao reagendar nota pendente %s: %v", pending.ID, err)
+		}
+		return
+	}
+	s.reject(ctx, pending, extractErr)
+}
+
+func (s *VerificationService) reject(ctx context.Context, pending models.Invoice, cause *ExtractError) {
+	invoice, err := s.invoiceService.rejectPending(ctx, pending, cause)
+	if err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			log.Printf("erro ao rejeitar nota pendente %s: %v", pending.ID, err)
+		}
+		return
+	}
+	s.notify(ctx, invoice)
+}
+
+func (s *VerificationService) notify(ctx context.Context, invoice models.Invoice) {
+	if s.notifier == nil {
+		return
+	}
+	if err := s.notifier.NotifyInvoice(ctx, invoice); err != nil {
+		log.Printf("erro ao avisar o usuário %s sobre a nota %s: %v", invoice.UserID, invoice.AccessKey, err)
+	}
+}
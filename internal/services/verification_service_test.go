@@ -0,0 +1,289 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/joaogustavosp/loyalty-api/internal/models"
+	"github.com/joaogustavosp/loyalty-api/internal/nfce"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestPendingBackoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		attempts int
+		cause    *ExtractError
+		want     time.Duration
+	}{
+		{"primeira tentativa", 0, nil, 5 * time.Minute},
+		{"dobra a cada tentativa", 1, &ExtractError{Code: CodeSefazUnavailable}, 10 * time.Minute},
+		{"terceira tentativa", 3, &ExtractError{Code: CodeSefazUnavailable}, 40 * time.Minute},
+		{"limitado ao máximo", 10, &ExtractError{Code: CodeSefazUnavailable}, pendingMaxBackoff},
+		{"contingência de hora em hora", 5, &ExtractError{Code: CodeContingencyPending}, time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pendingBackoff(tt.attempts, tt.cause); got != tt.want {
+				t.Errorf("pendingBackoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+			}
+		})
+	}
+}
+
+// newTestVerification monta o agendador sobre o cliente simulado; usuários e
+// notas dividem as mesmas respostas enfileiradas.
+func newTestVerification(mt *mtest.T, fetcher Fetcher) (*VerificationService, *recordingNotifier) {
+	users := NewUserService(mt.Coll)
+	invoices := NewInvoiceService(mt.Coll, users, DefaultReceiptAgePolicy(), nil, nil)
+	notifier := newRecordingNotifier()
+	return NewVerificationService(invoices, NewExtractService(fetcher, nil, nil), notifier, 72*time.Hour), notifier
+}
+
+// testPending é a nota do corpus guardada como pendente no dia seguinte à
+// emissão.
+func testPending(pendingUntil time.Time) models.Invoice {
+	claimedAt := time.Date(2023, 5, 16, 12, 0, 0, 0, nfce.Location)
+	return models.Invoice{
+		ID:           testInvoiceID,
+		UserID:       testUserID,
+		AccessKey:    testAccessKey,
+		Status:       models.InvoicePending,
+		SourceURL:    testQRCodeURL,
+		ClaimedAt:    &claimedAt,
+		PendingUntil: &pendingUntil,
+		Attempts:     1,
+	}
+}
+
+func updateResponse(n int32) bson.D {
+	return mtest.CreateSuccessResponse(bson.E{Key: "n", Value: n}, bson.E{Key: "nModified", Value: n})
+}
+
+func TestVerify(t *testing.T) {
+	mt := newMockDB(t)
+	later := time.Now().Add(72 * time.Hour)
+
+	mt.Run("nota verificada credita os pontos e avisa", func(mt *mtest.T) {
+		s, notifier := newTestVerification(mt, stubFetcher{body: fixturePage(t)})
+		mt.AddMockResponses(updateResponse(1), updateResponse(1))
+
+		s.verify(context.Background(), testPending(later))
+
+		commands := sentCommands(mt)
+		if names := commandNames(commands); !reflect.DeepEqual(names, []string{"update", "update"}) {
+			t.Fatalf("comandos enviados = %v", names)
+		}
+		replace := commands[0].Lookup("updates", "0").Document()
+		if status := replace.Lookup("q", "status").StringValue(); status != string(models.InvoicePending) {
+			t.Errorf("filtro da troca = %q, want só a nota pendente", status)
+		}
+		if status := replace.Lookup("u", "status").StringValue(); status != string(models.InvoiceVerified) {
+			t.Errorf("situação gravada = %q", status)
+		}
+		points := commands[1].Lookup("updates", "0", "u", "$inc", "points").Int64()
+		if points != 58 {
+			t.Errorf("pontos creditados = %d, want 58", points)
+		}
+
+		got := notifier.all()
+		if len(got) != 1 || got[0].Status != models.InvoiceVerified || got[0].Points != 58 || got[0].ID != testInvoiceID {
+			t.Errorf("avisos = %+v", got)
+		}
+	})
+
+	mt.Run("nota resolvida por outra instância", func(mt *mtest.T) {
+		s, notifier := newTestVerification(mt, stubFetcher{body: fixturePage(t)})
+		mt.AddMockResponses(updateResponse(0))
+
+		s.verify(context.Background(), testPending(later))
+
+		if names := commandNames(sentCommands(mt)); len(names) != 1 {
+			t.Errorf("comandos enviados = %v, want sem crédito de pontos", names)
+		}
+		if got := notifier.all(); len(got) != 0 {
+			t.Errorf("avisos = %+v, want nenhum", got)
+		}
+	})
+
+	rejections := []struct {
+		name    string
+		fetcher stubFetcher
+		pending models.Invoice
+		code    ErrorCode
+	}{
+		{
+			name:    "nota não encontrada",
+			fetcher: stubFetcher{err: &HTTPStatusError{StatusCode: http.StatusNotFound, Status: "404 Not Found"}},
+			pending: testPending(later),
+			code:    CodeInvoiceNotFound,
+		},
+		{
+			name:    "SEFAZ fora do ar depois do prazo",
+			fetcher: stubFetcher{err: &HTTPStatusError{StatusCode: http.StatusServiceUnavailable, Status: "503 Service Unavailable"}},
+			pending: testPending(time.Now().Add(time.Minute)),
+			code:    CodeSefazUnavailable,
+		},
+		{
+			name:    "nota fora do prazo na data do envio",
+			fetcher: stubFetcher{body: fixturePage(t)},
+			pending: func() models.Invoice {
+				p := testPending(later)
+				claimedAt := time.Date(2023, 8, 1, 12, 0, 0, 0, nfce.Location)
+				p.ClaimedAt = &claimedAt
+				return p
+			}(),
+			code: CodeInvoiceTooOld,
+		},
+	}
+	for _, tt := range rejections {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			s, notifier := newTestVerification(mt, tt.fetcher)
+			mt.AddMockResponses(updateResponse(1))
+
+			s.verify(context.Background(), tt.pending)
+
+			commands := sentCommands(mt)
+			if names := commandNames(commands); !reflect.DeepEqual(names, []string{"update"}) {
+				t.Fatalf("comandos enviados = %v", names)
+			}
+			set := commands[0].Lookup("updates", "0", "u", "$set").Document()
+			if status := set.Lookup("status").StringValue(); status != string(models.InvoiceRejected) {
+				t.Errorf("situação gravada = %q", status)
+			}
+			if code := set.Lookup("rejection_code").StringValue(); code != string(tt.code) {
+				t.Errorf("rejection_code = %q, want %q", code, tt.code)
+			}
+
+			got := notifier.all()
+			if len(got) != 1 || got[0].Status != models.InvoiceRejected || got[0].RejectionCode != string(tt.code) {
+				t.Errorf("avisos = %+v", got)
+			}
+		})
+	}
+
+	mt.Run("SEFAZ fora do ar reagenda sem avisar", func(mt *mtest.T) {
+		s, notifier := newTestVerification(mt, stubFetcher{err: &HTTPStatusError{StatusCode: http.StatusServiceUnavailable, Status: "503 Service Unavailable"}})
+		mt.AddMockResponses(updateResponse(1))
+
+		before := time.Now()
+		s.verify(context.Background(), testPending(later))
+
+		commands := sentCommands(mt)
+		if names := commandNames(commands); !reflect.DeepEqual(names, []string{"update"}) {
+			t.Fatalf("comandos enviados = %v", names)
+		}
+		next := commands[0].Lookup("updates", "0", "u", "$set", "next_attempt_at").Time()
+		// Segunda tentativa: o dobro do intervalo inicial
+		if want := before.Add(10 * time.Minute); next.Before(want.Add(-time.Second)) || next.After(want.Add(time.Minute)) {
+			t.Errorf("próxima tentativa = %v, want perto de %v", next, want)
+		}
+		if got := notifier.all(); len(got) != 0 {
+			t.Errorf("avisos = %+v, want nenhum", got)
+		}
+	})
+
+	mt.Run("rejeição feita por outra instância", func(mt *mtest.T) {
+		s, notifier := newTestVerification(mt, stubFetcher{err: &HTTPStatusError{StatusCode: http.StatusNotFound, Status: "404 Not Found"}})
+		mt.AddMockResponses(updateResponse(0))
+
+		s.verify(context.Background(), testPending(later))
+
+		if got := notifier.all(); len(got) != 0 {
+			t.Errorf("avisos = %+v, want nenhum", got)
+		}
+	})
+}
+
+func pendingDocument() bson.D {
+	id, _ := primitive.ObjectIDFromHex(testInvoiceID)
+	claimedAt := time.Date(2023, 5, 16, 12, 0, 0, 0, nfce.Location)
+	return bson.D{
+		{Key: "_id", Value: id},
+		{Key: "user_id", Value: testUserID},
+		{Key: "access_key", Value: testAccessKey},
+		{Key: "status", Value: models.InvoicePending},
+		{Key: "source_url", Value: testQRCodeURL},
+		{Key: "claimed_at", Value: claimedAt},
+		{Key: "pending_until", Value: time.Now().Add(72 * time.Hour)},
+		{Key: "attempts", Value: 1},
+	}
+}
+
+func TestNextPending(t *testing.T) {
+	mt := newMockDB(t)
+
+	mt.Run("reserva a nota vencida", func(mt *mtest.T) {
+		s := NewInvoiceService(mt.Coll, nil, ReceiptAgePolicy{}, nil, nil)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: pendingDocument()}))
+
+		before := time.Now()
+		pending, err := s.nextPending(context.Background())
+		if err != nil {
+			t.Fatalf("nextPending err = %v", err)
+		}
+		if pending.ID != testInvoiceID || pending.SourceURL != testQRCodeURL {
+			t.Errorf("nextPending = %+v", pending)
+		}
+
+		cmd := sentCommands(mt)[0]
+		if status := cmd.Lookup("query", "status").StringValue(); status != string(models.InvoicePending) {
+			t.Errorf("filtro de status = %q", status)
+		}
+		due := cmd.Lookup("query", "next_attempt_at", "$lte").Time()
+		if due.Before(before.Add(-time.Second)) {
+			t.Errorf("filtro de vencimento = %v", due)
+		}
+		lease := cmd.Lookup("update", "$set", "next_attempt_at").Time()
+		if lease.Before(before.Add(pendingLease - time.Second)) {
+			t.Errorf("reserva até %v, want %v depois de %v", lease, pendingLease, before)
+		}
+		if inc := cmd.Lookup("update", "$inc", "attempts").Int32(); inc != 1 {
+			t.Errorf("$inc attempts = %d", inc)
+		}
+	})
+
+	mt.Run("nenhuma nota vencida", func(mt *mtest.T) {
+		s := NewInvoiceService(mt.Coll, nil, ReceiptAgePolicy{}, nil, nil)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}))
+
+		if _, err := s.nextPending(context.Background()); !errors.Is(err, mongo.ErrNoDocuments) {
+			t.Fatalf("nextPending err = %v, want ErrNoDocuments", err)
+		}
+	})
+}
+
+func TestVerificationStart(t *testing.T) {
+	mt := newMockDB(t)
+
+	mt.Run("verifica as notas vencidas até esgotar", func(mt *mtest.T) {
+		s, notifier := newTestVerification(mt, stubFetcher{body: fixturePage(t)})
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: pendingDocument()}),
+			updateResponse(1),
+			updateResponse(1),
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}),
+		)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		s.Start(ctx)
+
+		select {
+		case <-notifier.notified:
+		case <-time.After(5 * time.Second):
+			t.Fatal("nenhum aviso depois de Start")
+		}
+		got := notifier.all()
+		if len(got) != 1 || got[0].Status != models.InvoiceVerified || got[0].Points != 58 {
+			t.Errorf("avisos = %+v", got)
+		}
+	})
+}
@@ -68,6 +68,99 @@ func IsValidCPF(cpf string) bool {
 	return string(cpf[9]) == strconv.Itoa(firstDigit) && string(cpf[10]) == strconv.Itoa(secondDigit)
 }
 
+// NormalizeCNPJ remove a formatação do CNPJ (pontos, barra, hífen e espaços) e
+// converte as letras para maiúsculas. O resultado não é validado.
+func NormalizeCNPJ(cnpj string) string {
+	cnpj = strings.NewReplacer(".", "", "/", "", "-", "", " ", "").Replace(strings.TrimSpace(cnpj))
+	return strings.ToUpper(cnpj)
+}
+
+// IsValidCNPJ verifica um CNPJ numérico ou alfanumérico, com ou sem
+// formatação. No formato alfanumérico, adotado a partir de 2026, as 12
+// primeiras posições aceitam letras e os dois dígitos verificadores continuam
+// numéricos; cada caractere vale o seu código ASCII menos 48, o que mantém o
+// cálculo dos CNPJs numéricos.
+func IsValidCNPJ(cnpj string) bool {
+	cnpj = NormalizeCNPJ(cnpj)
+	if len(cnpj) != 14 {
+		return false
+	}
+	for i := 0; i < 14; i++ {
+		c := cnpj[i]
+		isDigit := c >= '0' && c <= '9'
+		if !isDigit && (i >= 12 || c < 'A' || c > 'Z') {
+			return false
+		}
+	}
+	// Sequências repetidas, como 00.000.000/0000-00, passam no cálculo
+	if strings.Count(cnpj, cnpj[:1]) == 14 {
+		return false
+	}
+
+	first := cnpjCheckDigit(cnpj[:12])
+	second := cnpjCheckDigit(cnpj[:12] + strconv.Itoa(first))
+	return cnpj[12:] == strconv.Itoa(first)+strconv.Itoa(second)
+}
+
+// cnpjCheckDigit calcula um dígito verificador do CNPJ, módulo 11 com pesos
+// de 2 a 9 aplicados da direita para a esquerda.
+func cnpjCheckDigit(base string) int {
+	sum, weight := 0, 2
+	for i := len(base) - 1; i >= 0; i-- {
+		sum += int(base[i]-'0') * weight
+		weight++
+		if weight > 9 {
+			weight = 2
+		}
+	}
+	if sum%11 < 2 {
+		return 0
+	}
+	return 11 - sum%11
+}
+
+// FormatCNPJ formata um CNPJ válido como 00.000.000/0000-00, mantendo as
+// letras do formato alfanumérico. Valores inválidos voltam sem alteração.
+func FormatCNPJ(cnpj string) string {
+	if !IsValidCNPJ(cnpj) {
+		return cnpj
+	}
+	c := NormalizeCNPJ(cnpj)
+	return c[0:2] + "." + c[2:5] + "." + c[5:8] + "/" + c[8:12] + "-" + c[12:14]
+}
+
+// IsValidGTIN verifica um código de barras GTIN-8, GTIN-12 (UPC), GTIN-13
+// (EAN) ou GTIN-14 pelo dígito verificador do GS1. Códigos só com zeros, que
+// alguns sistemas emitem no lugar de "SEM GTIN", passam no dígito verificador
+// mas não identificam produto algum e são recusados.
+func IsValidGTIN(gtin string) bool {
+	switch len(gtin) {
+	case 8, 12, 13, 14:
+	default:
+		return false
+	}
+	if strings.Trim(gtin, "0") == "" {
+		return false
+	}
+	var sum int
+	for i := len(gtin) - 1; i >= 0; i-- {
+		if gtin[i] < '0' || gtin[i] > '9' {
+			return false
+		}
+		num := int(gtin[i] - '0')
+		if i == len(gtin)-1 {
+			continue
+		}
+		// Da direita para a esquerda, sem o verificador, os pesos alternam 3 e 1
+		if (len(gtin)-1-i)%2 == 1 {
+			sum += num * 3
+		} else {
+			sum += num
+		}
+	}
+	return int(gtin[len(gtin)-1]-'0') == (10-sum%10)%10
+}
+
 var jwtKey = []byte(os.Getenv("JWT_SECRET"))
 
 func GenerateJWTWithExpiration(userID interface{}, expirationTime time.Duration) (string, error) {
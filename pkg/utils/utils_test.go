@@ -0,0 +1,99 @@
+package utils
+
+import "testing"
+
+func TestIsValidCNPJ(t *testing.T) {
+	tests := []struct {
+		name string
+		cnpj string
+		want bool
+	}{
+		{"numérico sem formatação", "11222333000181", true},
+		{"numérico formatado", "11.222.333/0001-81", true},
+		{"numérico com espaços nas pontas", " 12.345.678/0001-95 ", true},
+		{"dígito verificador errado", "11.222.333/0001-82", false},
+		{"segundo dígito errado", "12345678000196", false},
+		{"sequência repetida", "00.000.000/0000-00", false},
+		{"sequência repetida de noves", "99999999999999", false},
+		{"curto demais", "1122233300018", false},
+		{"longo demais", "112223330001811", false},
+		{"vazio", "", false},
+		{"alfanumérico formatado", "12.ABC.345/01DE-35", true},
+		{"alfanumérico sem formatação", "12ABC34501DE35", true},
+		{"alfanumérico em minúsculas", "12.abc.345/01de-35", true},
+		{"alfanumérico com dígito errado", "12.ABC.345/01DE-36", false},
+		{"letra no dígito verificador", "12ABC34501DE3A", false},
+		{"caractere inválido", "12.AB#.345/01DE-35", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsValidCNPJ(tt.cnpj); got != tt.want {
+				t.Errorf("IsValidCNPJ(%q) = %v, want %v", tt.cnpj, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeCNPJ(t *testing.T) {
+	tests := []struct {
+		cnpj string
+		want string
+	}{
+		{"11.222.333/0001-81", "11222333000181"},
+		{"11222333000181", "11222333000181"},
+		{"12.abc.345/01de-35", "12ABC34501DE35"},
+		{" 12 ABC 345 01DE 35 ", "12ABC34501DE35"},
+	}
+	for _, tt := range tests {
+		if got := NormalizeCNPJ(tt.cnpj); got != tt.want {
+			t.Errorf("NormalizeCNPJ(%q) = %q, want %q", tt.cnpj, got, tt.want)
+		}
+	}
+}
+
+func TestFormatCNPJ(t *testing.T) {
+	tests := []struct {
+		cnpj string
+		want string
+	}{
+		{"11222333000181", "11.222.333/0001-81"},
+		{"12abc34501de35", "12.ABC.345/01DE-35"},
+		{"11222333000182", "11222333000182"},
+	}
+	for _, tt := range tests {
+		if got := FormatCNPJ(tt.cnpj); got != tt.want {
+			t.Errorf("FormatCNPJ(%q) = %q, want %q", tt.cnpj, got, tt.want)
+		}
+	}
+}
+
+func TestIsValidGTIN(t *testing.T) {
+	tests := []struct {
+		name string
+		gtin string
+		want bool
+	}{
+		{"EAN-13", "7891000100103", true},
+		{"EAN-13 de outro fabricante", "7894900011517", true},
+		{"GTIN-8", "96385074", true},
+		{"GTIN-12 (UPC)", "036000291452", true},
+		{"GTIN-14", "17891000100100", true},
+		{"dígito verificador errado", "7891000100104", false},
+		{"GTIN-8 com dígito errado", "96385075", false},
+		{"EAN-13 só com zeros", "0000000000000", false},
+		{"GTIN-8 só com zeros", "00000000", false},
+		{"GTIN-14 só com zeros", "00000000000000", false},
+		{"GTIN-12 com dígito errado", "789100010010", false},
+		{"tamanho de 11 dígitos", "78910001001", false},
+		{"letras", "789100010010A", false},
+		{"SEM GTIN", "SEM GTIN", false},
+		{"vazio", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsValidGTIN(tt.gtin); got != tt.want {
+				t.Errorf("IsValidGTIN(%q) = %v, want %v", tt.gtin, got, tt.want)
+			}
+		})
+	}
+}